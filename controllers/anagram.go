@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"gorm.io/gorm"
+)
+
+// anagramConversationLimit maximum number of earlier anagrams found in a conversation
+const anagramConversationLimit = 500
+
+// participants get the owner and recipients of a message, including recipients already stored in the db
+func participants(db *gorm.DB, message *models.Message) (map[uint]bool, hermesErrors.HermesError) {
+	users := map[uint]bool{message.OwnerID: true}
+	for _, recipient := range message.Recipients {
+		users[recipient.ID] = true
+	}
+
+	if message.ID != 0 {
+		var userIds []uint
+		result := db.Model(&models.Recipient{}).Where("message_id = ?", message.ID).Pluck("user_id", &userIds)
+		if result.Error != nil {
+			return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get recipients: %s\n", result.Error))
+		}
+		for _, userId := range userIds {
+			users[userId] = true
+		}
+	}
+	return users, nil
+}
+
+// checkAnagram find earlier messages in the same conversation that are anagrams of the message,
+// a conversation is every message sent between the same set of users
+func checkAnagram(db *gorm.DB, config *models.AnalysisConfig, message *models.Message) hermesErrors.HermesError {
+	if !config.AnalyzerEnabled("anagram") {
+		return nil
+	}
+
+	users, hermesError := participants(db, message)
+	if hermesError != nil {
+		return hermesError
+	}
+	userIds := make([]uint, 0, len(users))
+	for userId := range users {
+		userIds = append(userIds, userId)
+	}
+
+	//any message in the conversation must be owned by one of the participants, only messages with the same letters
+	//can be anagrams so the db compares the keys
+	var candidates []models.Message
+	if message.AnagramKey != "" {
+		result := db.Scopes(models.NotExpired).Preload("Recipients").Where("anagram_key = ?", message.AnagramKey).Where("owner_id IN ?", userIds).
+			Where("NOT draft").Where("id <> ?", message.ID).Order("id DESC").Limit(anagramConversationLimit).Find(&candidates)
+		if result.Error != nil {
+			return hermesErrors.InternalServerError(fmt.Sprintf("failed to get conversation: %s\n", result.Error))
+		}
+	}
+
+	matches := []uint{}
+	for _, candidate := range candidates {
+		if !models.IsAnagram(config, message.Text, candidate.Text) {
+			continue
+		}
+		candidateUsers := map[uint]bool{candidate.OwnerID: true}
+		for _, recipient := range candidate.Recipients {
+			candidateUsers[recipient.ID] = true
+		}
+		if sameUsers(users, candidateUsers) {
+			matches = append(matches, candidate.ID)
+		}
+	}
+
+	if message.Analysis == nil {
+		message.Analysis = models.Analysis{}
+	}
+	message.Analysis["anagram"] = models.AnalysisResult{
+		Result:  len(matches) > 0,
+		Details: map[string]interface{}{"message_ids": matches},
+	}
+	return nil
+}
+
+// sameUsers check if two sets of users are equal
+func sameUsers(a map[uint]bool, b map[uint]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for userId := range a {
+		if !b[userId] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+package controllers
+
+import "github.com/Daniel-W-Innes/hermes/models"
+
+// Analyze run the same word play analysis as Message.Check on the text without touching the db,
+// the anagram check is skipped since it needs a conversation
+func Analyze(config *models.Config, request *models.AnalysisRequest) *models.AnalysisReport {
+	return models.NewAnalysisReport(&config.AnalysisConfig, request.Text)
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// AddAttachment store an uploaded file by its sha256 and link it to a message owned by the user
+func AddAttachment(db *gorm.DB, store storage.BlobStore, config *models.AttachmentConfig, file *multipart.FileHeader, messageId int, userId uint) (*models.Attachment, hermesErrors.HermesError) {
+	var message models.Message
+
+	//get message from db where user is owner
+	result := db.Scopes(models.NotExpired).Where("id = ?", messageId).Where("owner_id = ?", userId).Limit(1).Find(&message)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.MessageDoesNotExits()
+	}
+
+	//reject large files before reading them
+	if file.Size > config.MaxSize {
+		return nil, hermesErrors.AttachmentTooLarge(config.MaxSize)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to open attachment: %s\n", err))
+	}
+	defer f.Close()
+
+	//read one byte past the limit to catch files that lied about their size
+	data, err := io.ReadAll(io.LimitReader(f, config.MaxSize+1))
+	if err != nil {
+		return nil, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to read attachment: %s\n", err))
+	}
+	if int64(len(data)) > config.MaxSize {
+		return nil, hermesErrors.AttachmentTooLarge(config.MaxSize)
+	}
+
+	//sniff the type from the content instead of trusting the client
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to parse detected content type: %s\n", err))
+	}
+	if !config.TypeAllowed(contentType) {
+		return nil, hermesErrors.AttachmentTypeNotAllowed(contentType)
+	}
+
+	//address the blob by its content so identical files are only stored once
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	attachment := models.Attachment{
+		MessageID:   message.ID,
+		Filename:    filepath.Base(file.Filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Hash:        hash,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		//take the reference before storing so the reaper can not delete the blob between the two, the row lock is held
+		//until the attachment is added
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"refs": gorm.Expr("blobs.refs + 1"), "updated_at": time.Now()}),
+		}).Create(&models.Blob{Hash: hash, Refs: 1}).Error
+		if err != nil {
+			return err
+		}
+		err = store.Put(hash, bytes.NewReader(data), int64(len(data)), contentType)
+		if err != nil {
+			return fmt.Errorf("failed to store attachment: %w", err)
+		}
+		return tx.Create(&attachment).Error
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to add attachment: %s\n", err))
+	}
+
+	return &attachment, nil
+}
+
+// GetAttachment open an attachment of a message owned by or sent to the user. Only the owner can download the
+// attachments of a view once message, a recipient could otherwise keep downloading them without using up the message.
+func GetAttachment(db *gorm.DB, store storage.BlobStore, messageId int, attachmentId int, userId uint) (*models.Attachment, io.ReadCloser, hermesErrors.HermesError) {
+	var message models.Message
+	result := db.Scopes(models.VisibleTo(userId)).Select("messages.owner_id", "messages.view_once").Where("messages.id = ?", messageId).Limit(1).Find(&message)
+	if result.Error != nil {
+		return nil, nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, hermesErrors.AttachmentDoesNotExits()
+	}
+	if message.ViewOnce && message.OwnerID != userId {
+		return nil, nil, hermesErrors.ViewOnceAttachment()
+	}
+
+	var attachment models.Attachment
+	result = db.Where("id = ?", attachmentId).Where("message_id = ?", messageId).Limit(1).Find(&attachment)
+	if result.Error != nil {
+		return nil, nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get attachment: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, hermesErrors.AttachmentDoesNotExits()
+	}
+
+	blob, err := store.Get(attachment.Hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, hermesErrors.InternalServerError(fmt.Sprintf("attachment %d is missing blob %s\n", attachment.ID, attachment.Hash))
+		}
+		return nil, nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get attachment blob: %s\n", err))
+	}
+
+	return &attachment, blob, nil
+}
+
+// retainBlobs take a reference on the blobs shared by copied attachments, the blobs must still be referenced by the
+// attachments they were copied from. Call inside a transaction
+func retainBlobs(tx *gorm.DB, attachments []models.Attachment) error {
+	for _, attachment := range attachments {
+		result := tx.Model(&models.Blob{}).Where("hash = ?", attachment.Hash).Where("refs > 0").Updates(map[string]interface{}{"refs": gorm.Expr("refs + 1"), "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		//the attachments were removed since they were copied and the blob may already be deleted
+		if result.RowsAffected == 0 {
+			return hermesErrors.MessageDoesNotExits()
+		}
+	}
+	return nil
+}
+
+// releaseAttachments remove the attachments of the messages and drop the references they held on their blobs. Call
+// inside a transaction
+func releaseAttachments(tx *gorm.DB, messageIds interface{}) error {
+	var refs []struct {
+		Hash  string
+		Count int
+	}
+	err := tx.Model(&models.Attachment{}).Select("hash", "count(*) AS count").Where("message_id IN (?)", messageIds).Group("hash").Scan(&refs).Error
+	if err != nil || len(refs) == 0 {
+		return err
+	}
+	for _, ref := range refs {
+		err = tx.Model(&models.Blob{}).Where("hash = ?", ref.Hash).Updates(map[string]interface{}{"refs": gorm.Expr("refs - ?", ref.Count), "updated_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Where("message_id IN (?)", messageIds).Delete(&models.Attachment{}).Error
+}
+
+// ReapBlobs delete the stored blobs that no attachment references anymore
+func ReapBlobs(db *gorm.DB, store storage.BlobStore) (int64, hermesErrors.HermesError) {
+	var hashes []string
+	result := db.Model(&models.Blob{}).Where("refs <= 0").Pluck("hash", &hashes)
+	if result.Error != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get unreferenced blobs: %s\n", result.Error))
+	}
+
+	var reaped int64
+	for _, hash := range hashes {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			//the row lock keeps new references waiting until the blob is gone, a new upload then stores it again
+			result := tx.Where("hash = ?", hash).Where("refs <= 0").Delete(&models.Blob{})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			err := store.Delete(hash)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			reaped++
+			return nil
+		})
+		if err != nil {
+			return reaped, hermesErrors.InternalServerError(fmt.Sprintf("failed to reap blob %s: %s\n", hash, err))
+		}
+	}
+	return reaped, nil
+}
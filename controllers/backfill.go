@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// backfillRunning set while this instance is running a backfill so requests do not start a second worker
+var backfillRunning int32
+
+// GetBackfill get the latest backfill job
+func GetBackfill(db *gorm.DB) (*models.BackfillJob, hermesErrors.HermesError) {
+	job := models.BackfillJob{}
+	result := db.Last(&job)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, hermesErrors.BackfillDoesNotExits()
+	} else if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get backfill job: %s\n", result.Error))
+	}
+	return &job, nil
+}
+
+// StartBackfill create a backfill job for the current analysis version, an unfinished job is resumed instead
+func StartBackfill(db *gorm.DB, request *models.BackfillRequest) (*models.BackfillJob, hermesErrors.HermesError) {
+	job := &models.BackfillJob{}
+	result := db.Where("finished_at IS NULL").Last(job)
+	if result.Error == nil {
+		return job, nil
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get unfinished backfill job: %s\n", result.Error))
+	}
+
+	job = &models.BackfillJob{Version: models.AnalysisVersion, All: request.All}
+	result = db.Model(&models.Message{}).Scopes(job.Stale).Count(&job.Total)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to count stale messages: %s\n", result.Error))
+	}
+
+	result = db.Create(job)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to create backfill job: %s\n", result.Error))
+	}
+	return job, nil
+}
+
+// backfillBatch analyse the next batch of messages and move the job cursor past them, the job row is locked so
+// workers on other instances can not analyse the same batch
+func backfillBatch(db *gorm.DB, config *models.Config, jobId uint) (*models.BackfillJob, hermesErrors.HermesError) {
+	job := models.BackfillJob{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&job, jobId)
+		if result.Error != nil {
+			return result.Error
+		} else if job.FinishedAt != nil {
+			return nil
+		}
+
+		var messages []models.Message
+		result = tx.Scopes(job.Stale).Preload("Recipients").Order("id").Limit(config.BackfillConfig.BatchSize).Find(&messages)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for i := range messages {
+			messages[i].Check(&config.AnalysisConfig)
+			if hermesError := checkAnagram(tx, &config.AnalysisConfig, &messages[i]); hermesError != nil {
+				return hermesError
+			}
+			// update columns directly so the backfill does not look like an edit
+			result = tx.Model(&messages[i]).Select("palindrome", "palindrome_normalised", "analysis", "longest_palindromes", "anagram_key", "analysis_version").UpdateColumns(&messages[i])
+			if result.Error != nil {
+				return result.Error
+			}
+			job.Cursor = messages[i].ID
+		}
+
+		job.Processed += int64(len(messages))
+		if len(messages) < config.BackfillConfig.BatchSize {
+			finishedAt := time.Now()
+			job.FinishedAt = &finishedAt
+		}
+		if result = tx.Save(&job); result.Error != nil {
+			return result.Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to backfill batch of job %d: %s\n", jobId, err))
+	}
+	return &job, nil
+}
+
+// RunBackfill analyse batches until the job is finished, pausing between batches to throttle the load on the db.
+// Returns false without doing anything if this instance is already running a backfill.
+func RunBackfill(db *gorm.DB, config *models.Config, jobId uint) (bool, hermesErrors.HermesError) {
+	if !atomic.CompareAndSwapInt32(&backfillRunning, 0, 1) {
+		return false, nil
+	}
+	defer atomic.StoreInt32(&backfillRunning, 0)
+
+	for {
+		job, hermesError := backfillBatch(db, config, jobId)
+		if hermesError != nil {
+			return true, hermesError
+		}
+		log.Printf("backfill %d analysed %d of %d messages\n", job.ID, job.Processed, job.Total)
+		if job.FinishedAt != nil {
+			return true, nil
+		}
+		time.Sleep(config.BackfillConfig.BatchDelay)
+	}
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// archiveFolder get the user's archive folder creating it the first time they archive, a label the user made with the
+// same name is not used as the archive
+func archiveFolder(tx *gorm.DB, userId uint) (*models.Label, error) {
+	label := models.Label{UserID: userId, Name: models.ArchiveFolder, Folder: true}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&label)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		label = models.Label{}
+		result = tx.Where("user_id = ?", userId).Where("name = ?", models.ArchiveFolder).Where("folder").Limit(1).Find(&label)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, hermesErrors.ArchiveNameTaken()
+		}
+	}
+	return &label, nil
+}
+
+// batchLabel apply a label to a message the user can see
+func batchLabel(tx *gorm.DB, label *models.Label, messageId uint, userId uint) error {
+	messageIds, hermesError := visibleIds(tx, []uint{messageId}, userId)
+	if hermesError != nil {
+		return hermesError
+	}
+	if len(messageIds) == 0 {
+		return hermesErrors.MessageDoesNotExits()
+	}
+	return applyLabel(tx, label, messageIds)
+}
+
+// batchOperation apply one operation, a hermes error is the result of the operation any other error fails the batch
+func batchOperation(tx *gorm.DB, operation *models.BatchOperation, userId uint) error {
+	switch operation.Op {
+	case models.BatchDelete:
+		return deleteMessage(tx, int(operation.MessageID), userId)
+	case models.BatchRead:
+		var message models.Message
+		result := tx.Scopes(models.VisibleTo(userId)).Select("id", "owner_id").Where("id = ?", operation.MessageID).Limit(1).Find(&message)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return hermesErrors.MessageDoesNotExits()
+		}
+		//the owner has nothing to read
+		if message.OwnerID == userId {
+			return nil
+		}
+		return markRead(tx, &message, userId)
+	case models.BatchArchive:
+		label, err := archiveFolder(tx, userId)
+		if err != nil {
+			return err
+		}
+		return batchLabel(tx, label, operation.MessageID, userId)
+	case models.BatchLabel:
+		label, hermesError := getLabel(tx, int(operation.LabelID), userId)
+		if hermesError != nil {
+			return hermesError
+		}
+		return batchLabel(tx, label, operation.MessageID, userId)
+	}
+	return hermesErrors.UnprocessableEntity(fmt.Sprintf("unknown batch operation %s\n", operation.Op))
+}
+
+// BatchMessages apply the operations in a single transaction. Each operation is run in a savepoint so one that fails
+// is rolled back on its own and reported in its result, a database failure rolls back the whole batch.
+func BatchMessages(db *gorm.DB, request *models.BatchRequest, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	results := make([]models.BatchResult, len(request.Operations))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range request.Operations {
+			operation := &request.Operations[i]
+			results[i] = models.BatchResult{Op: operation.Op, MessageID: operation.MessageID, Status: fiber.StatusOK}
+
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return batchOperation(tx, operation, userId)
+			})
+			if hermesError, ok := err.(hermesErrors.HermesError); ok {
+				hermesError.LogPrivate()
+				results[i].Status = hermesError.StatusCode()
+				results[i].Error = hermesError.Error()
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to apply batch: %s\n", err))
+	}
+	wakeRelay()
+	return fiber.Map{"results": results}, nil
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// blockError convert an error from blocking or muting, only existing users can be blocked or muted
+func blockError(err error, action string) hermesErrors.HermesError {
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	if err, ok := err.(*pgconn.PgError); ok && err.Code == "23503" {
+		return hermesErrors.UserDoesNotExits()
+	}
+	return hermesErrors.InternalServerError(fmt.Sprintf("failed to %s: %s\n", action, err))
+}
+
+// AddBlock stop the blocked user from sending messages to the user
+func AddBlock(db *gorm.DB, blockedId uint, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	if blockedId == userId {
+		return nil, hermesErrors.BlockSelf()
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Block{UserID: userId, BlockedID: blockedId})
+	if result.Error != nil {
+		return nil, blockError(result.Error, "block user")
+	}
+	return fiber.Map{"result": "user blocked"}, nil
+}
+
+// RemoveBlock let the blocked user send messages to the user again
+func RemoveBlock(db *gorm.DB, blockedId uint, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	result := db.Where("user_id = ?", userId).Where("blocked_id = ?", blockedId).Delete(&models.Block{})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to unblock user: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.UserDoesNotExits()
+	}
+	return fiber.Map{"result": "user unblocked"}, nil
+}
+
+// GetBlocks get the users the user has blocked
+func GetBlocks(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	var blocks []models.Block
+	result := db.Where("user_id = ?", userId).Order("created_at").Find(&blocks)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get blocked users: %s\n", result.Error))
+	}
+	return fiber.Map{"blocked": blocks}, nil
+}
+
+// AddMute hide or flag the messages the user gets from the muted user
+func AddMute(db *gorm.DB, mutedId uint, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	if mutedId == userId {
+		return nil, hermesErrors.BlockSelf()
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Mute{UserID: userId, MutedID: mutedId})
+	if result.Error != nil {
+		return nil, blockError(result.Error, "mute user")
+	}
+	return fiber.Map{"result": "user muted"}, nil
+}
+
+// RemoveMute show the messages the user gets from the muted user again
+func RemoveMute(db *gorm.DB, mutedId uint, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	result := db.Where("user_id = ?", userId).Where("muted_id = ?", mutedId).Delete(&models.Mute{})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to unmute user: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.UserDoesNotExits()
+	}
+	return fiber.Map{"result": "user unmuted"}, nil
+}
+
+// GetMutes get the users the user has muted
+func GetMutes(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	var mutes []models.Mute
+	result := db.Where("user_id = ?", userId).Order("created_at").Find(&mutes)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get muted users: %s\n", result.Error))
+	}
+	return fiber.Map{"muted": mutes}, nil
+}
+
+// blockedRecipients get the recipients that have blocked the sender
+func blockedRecipients(db *gorm.DB, recipientIds []uint, senderId uint) ([]uint, hermesErrors.HermesError) {
+	if len(recipientIds) == 0 {
+		return nil, nil
+	}
+	var blockedIds []uint
+	result := db.Model(&models.Block{}).Where("user_id IN ?", recipientIds).Where("blocked_id = ?", senderId).Pluck("user_id", &blockedIds)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get blocks: %s\n", result.Error))
+	}
+	return blockedIds, nil
+}
+
+// notMuted scope a message query to messages from users the user has not muted
+func notMuted(userId uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.user_id = ? AND mutes.muted_id = messages.owner_id)", userId)
+	}
+}
+
+// flagMuted mark the messages from users the user has muted
+func flagMuted(db *gorm.DB, messages []models.Message, userId uint) hermesErrors.HermesError {
+	if len(messages) == 0 {
+		return nil
+	}
+	var mutedIds []uint
+	result := db.Model(&models.Mute{}).Where("user_id = ?", userId).Pluck("muted_id", &mutedIds)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get muted users: %s\n", result.Error))
+	}
+	muted := map[uint]bool{}
+	for _, mutedId := range mutedIds {
+		muted[mutedId] = true
+	}
+	for i := range messages {
+		messages[i].Muted = muted[messages[i].OwnerID]
+	}
+	return nil
+}
+
+// removeBlocked reject a message if any of its recipients have blocked the owner, or if configured remove them from the
+// recipients and return their ids
+func removeBlocked(db *gorm.DB, config *models.BlockConfig, message *models.Message) ([]uint, hermesErrors.HermesError) {
+	recipientIds := make([]uint, len(message.Recipients))
+	for i, recipient := range message.Recipients {
+		recipientIds[i] = recipient.ID
+	}
+	blockedIds, hermesError := blockedRecipients(db, recipientIds, message.OwnerID)
+	if hermesError != nil || len(blockedIds) == 0 {
+		return nil, hermesError
+	}
+	if !config.DropBlocked {
+		return nil, hermesErrors.RecipientBlocked()
+	}
+
+	blocked := map[uint]bool{}
+	for _, blockedId := range blockedIds {
+		blocked[blockedId] = true
+	}
+	recipients := message.Recipients[:0]
+	for _, recipient := range message.Recipients {
+		if !blocked[recipient.ID] {
+			recipients = append(recipients, recipient)
+		}
+	}
+	message.Recipients = recipients
+	return blockedIds, nil
+}
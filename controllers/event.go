@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// recipientIds get the users a message was sent to that have not removed it, including the members of live groups
+func recipientIds(db *gorm.DB, messageId uint) ([]uint, hermesErrors.HermesError) {
+	var userIds []uint
+	result := db.Model(&models.Recipient{}).Where("message_id = ?", messageId).Pluck("user_id", &userIds)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get recipients: %s\n", result.Error))
+	}
+
+	var memberIds []uint
+	result = db.Model(&models.GroupMember{}).
+		Joins("JOIN message_groups mg ON mg.group_id = group_members.group_id AND mg.live").
+		Joins("JOIN messages m ON m.id = mg.message_id").
+		Where("mg.message_id = ?", messageId).Where("group_members.user_id <> m.owner_id").
+		Where("NOT EXISTS (SELECT 1 FROM blocks b WHERE b.user_id = group_members.user_id AND b.blocked_id = m.owner_id)").
+		Pluck("group_members.user_id", &memberIds)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get group members: %s\n", result.Error))
+	}
+	return uniqueIds(append(userIds, memberIds...)), nil
+}
+
+// recordEvents store an event of the type for each user in the outbox, call inside the transaction making the change so
+// the events are only kept if the change is
+func recordEvents(tx *gorm.DB, eventType string, messageId uint, userIds []uint) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	stored := make([]models.Event, len(userIds))
+	for i, userId := range userIds {
+		stored[i] = models.Event{UserID: userId, Type: eventType, MessageID: messageId}
+	}
+	return tx.Create(&stored).Error
+}
+
+// recordMessageEvents record a change for the owner and, if the message was sent, its recipients
+func recordMessageEvents(tx *gorm.DB, eventType string, message *models.Message) error {
+	userIds := []uint{message.OwnerID}
+	if !message.Draft {
+		recipients, hermesError := recipientIds(tx, message.ID)
+		if hermesError != nil {
+			return hermesError
+		}
+		userIds = append(userIds, recipients...)
+	}
+	return recordEvents(tx, eventType, message.ID, userIds)
+}
+
+// recordRecipientEvents record that a message was sent to each of its recipients
+func recordRecipientEvents(tx *gorm.DB, messageId uint) error {
+	recipients, hermesError := recipientIds(tx, messageId)
+	if hermesError != nil {
+		return hermesError
+	}
+	return recordEvents(tx, models.EventRecipientAdded, messageId, recipients)
+}
+
+// GetEvents get the user's published events after the position of the last event the client saw
+func GetEvents(db *gorm.DB, userId uint, lastPosition uint64) ([]models.Event, hermesErrors.HermesError) {
+	var stored []models.Event
+	result := db.Where("user_id = ?", userId).Where("position > ?", lastPosition).Order("position").Find(&stored)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get events: %s\n", result.Error))
+	}
+	return stored, nil
+}
+
+// ReapEvents remove published events older than the retention, clients can no longer resume from them. Expired
+// tickets are removed at the same time.
+func ReapEvents(db *gorm.DB, retention time.Duration) (int64, hermesErrors.HermesError) {
+	result := db.Where("expires_at <= ?", time.Now()).Delete(&models.EventTicket{})
+	if result.Error != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to reap event tickets: %s\n", result.Error))
+	}
+
+	result = db.Where("created_at <= ?", time.Now().Add(-retention)).Where("published_at IS NOT NULL").Delete(&models.Event{})
+	if result.Error != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to reap events: %s\n", result.Error))
+	}
+	return result.RowsAffected, nil
+}
+
+// AddEventTicket create a single use ticket that opens one event connection for the user
+func AddEventTicket(db *gorm.DB, config *models.EventConfig, userId uint) (*models.EventTicket, hermesErrors.HermesError) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to generate ticket: %s\n", err))
+	}
+
+	ticket := models.EventTicket{Ticket: hex.EncodeToString(secret), UserID: userId, ExpiresAt: time.Now().Add(config.TicketTTL)}
+	if err := db.Create(&ticket).Error; err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to add ticket: %s\n", err))
+	}
+	return &ticket, nil
+}
+
+// UseEventTicket get the user an unexpired ticket was issued to and remove the ticket so it can not be used again
+func UseEventTicket(db *gorm.DB, ticket string) (uint, hermesErrors.HermesError) {
+	var used []models.EventTicket
+	result := db.Clauses(clause.Returning{}).Where("ticket = ?", ticket).Where("expires_at > ?", time.Now()).Delete(&used)
+	if result.Error != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to use ticket: %s\n", result.Error))
+	}
+	if len(used) == 0 {
+		return 0, hermesErrors.NotValidToken()
+	}
+	return used[0].UserID, nil
+}
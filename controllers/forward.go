@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"gorm.io/gorm"
+)
+
+// ForwardMessage forward a message the user can see to new recipients. The forward is a new message owned by the user
+// with the text, analysis, attachments and expiry of the original along with a record of the message it came from.
+func ForwardMessage(db *gorm.DB, config *models.Config, messageId int, request *models.ForwardRequest, userId uint) (interface{}, hermesErrors.HermesError) {
+	var original models.Message
+
+	//get message from db where user is owner or a recipient, the same as getting the message
+	result := db.Scopes(models.VisibleTo(userId)).Preload("Attachments").Where("id = ?", messageId).Limit(1).Find(&original)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message: %s\n", result.Error))
+	}
+
+	//drafts have not been checked yet, the owner sends them instead of forwarding
+	if result.RowsAffected == 0 || original.Draft {
+		return nil, hermesErrors.MessageDoesNotExits()
+	}
+
+	//a forward would outlive the single view of the original
+	if original.ViewOnce {
+		return nil, hermesErrors.ViewOnceForward()
+	}
+
+	//the blobs are addressed by their content so the forward can share them with the original
+	attachments := make([]models.Attachment, len(original.Attachments))
+	for i, attachment := range original.Attachments {
+		attachments[i] = models.Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			Hash:        attachment.Hash,
+		}
+	}
+
+	forward := models.Message{
+		OwnerID:              userId,
+		Text:                 original.Text,
+		Palindrome:           original.Palindrome,
+		PalindromeNormalised: original.PalindromeNormalised,
+		Analysis:             original.Analysis,
+		LongestPalindromes:   original.LongestPalindromes,
+		AnalysisVersion:      original.AnalysisVersion,
+		AnagramKey:           original.AnagramKey,
+		ExpiresAt:            original.ExpiresAt,
+		Recipients:           request.Recipients,
+		GroupIDs:             request.GroupIDs,
+		Attachments:          attachments,
+		ForwardedFrom: &models.Provenance{
+			MessageID: original.ID,
+			OwnerID:   original.OwnerID,
+			CreatedAt: original.CreatedAt,
+		},
+	}
+	return createMessage(db, config, &forward, userId)
+}
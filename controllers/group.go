@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// groupAuditLimit most changes returned from a group's audit log
+const groupAuditLimit = 100
+
+// audit record changes to a group's membership, call inside the transaction making the changes
+func audit(tx *gorm.DB, groupId uint, actorId uint, action string, userIds ...uint) error {
+	entries := make([]models.GroupAudit, len(userIds))
+	for i, userId := range userIds {
+		entries[i] = models.GroupAudit{GroupID: groupId, ActorID: actorId, UserID: userId, Action: action}
+	}
+	return tx.Create(&entries).Error
+}
+
+// memberError convert an error from changing members, members must be existing users
+func memberError(err error, action string) hermesErrors.HermesError {
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	if err, ok := err.(*pgconn.PgError); ok && err.Code == "23503" && err.ConstraintName == "fk_group_members_user" {
+		return hermesErrors.MemberDoesNotExits()
+	}
+	return hermesErrors.InternalServerError(fmt.Sprintf("failed to %s: %s\n", action, err))
+}
+
+// getGroup get a group the user is a member of along with the user's membership
+func getGroup(db *gorm.DB, groupId int, userId uint) (*models.Group, *models.GroupMember, hermesErrors.HermesError) {
+	var group models.Group
+	result := db.Preload("Members").Limit(1).Find(&group, groupId)
+	if result.Error != nil {
+		return nil, nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get group: %s\n", result.Error))
+	}
+	if result.RowsAffected > 0 {
+		for i := range group.Members {
+			if group.Members[i].UserID == userId {
+				return &group, &group.Members[i], nil
+			}
+		}
+	}
+	return nil, nil, hermesErrors.GroupDoesNotExits()
+}
+
+// getAdministeredGroup get a group the user is an admin of
+func getAdministeredGroup(db *gorm.DB, groupId int, userId uint) (*models.Group, hermesErrors.HermesError) {
+	group, member, hermesError := getGroup(db, groupId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	if !member.Admin {
+		return nil, hermesErrors.NotGroupAdmin()
+	}
+	return group, nil
+}
+
+// AddGroup create a group owned by the user, the owner is always an admin member
+func AddGroup(db *gorm.DB, group *models.Group, userId uint) (*models.Group, hermesErrors.HermesError) {
+	group.ID = 0
+	group.OwnerID = userId
+
+	members := []models.GroupMember{{UserID: userId, Admin: true}}
+	memberIds := []uint{userId}
+	seen := map[uint]bool{userId: true}
+	for _, member := range group.Members {
+		if !seen[member.UserID] {
+			seen[member.UserID] = true
+			members = append(members, models.GroupMember{UserID: member.UserID, Admin: member.Admin})
+			memberIds = append(memberIds, member.UserID)
+		}
+	}
+	group.Members = members
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		if err := audit(tx, group.ID, userId, models.GroupCreated, userId); err != nil {
+			return err
+		}
+		return audit(tx, group.ID, userId, models.MemberAdded, memberIds...)
+	})
+	if err != nil {
+		return nil, memberError(err, "add group")
+	}
+	return group, nil
+}
+
+// GetGroups get the groups the user is a member of
+func GetGroups(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	var groups []models.Group
+	member := db.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userId)
+	result := db.Preload("Members").Where("id IN (?)", member).Order("id").Find(&groups)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get groups: %s\n", result.Error))
+	}
+	return fiber.Map{"groups": groups}, nil
+}
+
+// GetGroup get a group the user is a member of
+func GetGroup(db *gorm.DB, groupId int, userId uint) (*models.Group, hermesErrors.HermesError) {
+	group, _, hermesError := getGroup(db, groupId, userId)
+	return group, hermesError
+}
+
+// DeleteGroup delete a group owned by the user, messages sent to it as a live group are no longer seen by its members
+func DeleteGroup(db *gorm.DB, groupId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", groupId).Where("owner_id = ?", userId).Delete(&models.Group{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return hermesErrors.GroupDoesNotExits()
+		}
+		return audit(tx, uint(groupId), userId, models.GroupDeleted, userId)
+	})
+	if err != nil {
+		if hermesError, ok := err.(hermesErrors.HermesError); ok {
+			return nil, hermesError
+		}
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to delete group: %s\n", err))
+	}
+	return fiber.Map{"result": "group deleted"}, nil
+}
+
+// SetMember add a user to a group the user administers or change whether a member is an admin
+func SetMember(db *gorm.DB, groupId int, member *models.GroupMember, userId uint) (*models.Group, hermesErrors.HermesError) {
+	group, hermesError := getAdministeredGroup(db, groupId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	if member.UserID == group.OwnerID {
+		return nil, hermesErrors.GroupOwnerChange()
+	}
+
+	var actions []string
+	existing := -1
+	for i := range group.Members {
+		if group.Members[i].UserID == member.UserID {
+			existing = i
+		}
+	}
+	if existing < 0 {
+		actions = append(actions, models.MemberAdded)
+		if member.Admin {
+			actions = append(actions, models.AdminGranted)
+		}
+	} else if member.Admin != group.Members[existing].Admin {
+		if member.Admin {
+			actions = append(actions, models.AdminGranted)
+		} else {
+			actions = append(actions, models.AdminRevoked)
+		}
+	}
+	if len(actions) == 0 {
+		return group, nil
+	}
+
+	member.GroupID = group.ID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "group_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"admin"}),
+		}).Create(member)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, action := range actions {
+			if err := audit(tx, group.ID, userId, action, member.UserID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, memberError(err, "set member")
+	}
+
+	if existing < 0 {
+		group.Members = append(group.Members, *member)
+	} else {
+		group.Members[existing].Admin = member.Admin
+	}
+	return group, nil
+}
+
+// RemoveMember remove a member from a group, admins can remove anyone but the owner and members can leave
+func RemoveMember(db *gorm.DB, groupId int, memberId uint, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	group, member, hermesError := getGroup(db, groupId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	if memberId != userId && !member.Admin {
+		return nil, hermesErrors.NotGroupAdmin()
+	}
+	if memberId == group.OwnerID {
+		return nil, hermesErrors.GroupOwnerChange()
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("group_id = ?", group.ID).Where("user_id = ?", memberId).Delete(&models.GroupMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return hermesErrors.MemberDoesNotExits()
+		}
+		return audit(tx, group.ID, userId, models.MemberRemoved, memberId)
+	})
+	if err != nil {
+		if hermesError, ok := err.(hermesErrors.HermesError); ok {
+			return nil, hermesError
+		}
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to remove member: %s\n", err))
+	}
+	return fiber.Map{"result": "member removed"}, nil
+}
+
+// GetGroupAudit get the latest membership changes to a group the user administers, newest first
+func GetGroupAudit(db *gorm.DB, groupId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	group, hermesError := getAdministeredGroup(db, groupId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	var entries []models.GroupAudit
+	result := db.Where("group_id = ?", group.ID).Order("id DESC").Limit(groupAuditLimit).Find(&entries)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get group audit: %s\n", result.Error))
+	}
+	return fiber.Map{"audit": entries}, nil
+}
+
+// checkGroups check the user is a member of every group a message is sent to
+func checkGroups(db *gorm.DB, groupIds []uint, userId uint) hermesErrors.HermesError {
+	if len(groupIds) == 0 {
+		return nil
+	}
+	var count int64
+	result := db.Model(&models.GroupMember{}).Where("group_id IN ?", groupIds).Where("user_id = ?", userId).Count(&count)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get groups: %s\n", result.Error))
+	}
+	if count != int64(len(groupIds)) {
+		return hermesErrors.GroupDoesNotExits()
+	}
+	return nil
+}
+
+// uniqueIds remove repeated ids keeping the first of each
+func uniqueIds(ids []uint) []uint {
+	seen := map[uint]bool{}
+	var unique []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// linkGroups record the groups a message is sent to, whether they are live is fixed when the message is created
+func linkGroups(tx *gorm.DB, config *models.GroupConfig, messageId uint, groupIds []uint) error {
+	if len(groupIds) == 0 {
+		return nil
+	}
+	links := make([]models.MessageGroup, len(groupIds))
+	for i, groupId := range groupIds {
+		links[i] = models.MessageGroup{MessageID: messageId, GroupID: groupId, Live: config.Live}
+	}
+	return tx.Create(&links).Error
+}
+
+// expandGroups copy the current members of the groups a message is sent to into its recipients, live groups are skipped
+// as their members are checked when the message is read. Members that have blocked the owner are always left out.
+func expandGroups(tx *gorm.DB, message *models.Message) error {
+	return tx.Exec("INSERT INTO recipients (message_id, user_id) "+
+		"SELECT DISTINCT mg.message_id, gm.user_id FROM message_groups mg JOIN group_members gm ON mg.group_id = gm.group_id "+
+		"WHERE mg.message_id = ? AND NOT mg.live AND gm.user_id <> ? "+
+		"AND NOT EXISTS (SELECT 1 FROM blocks b WHERE b.user_id = gm.user_id AND b.blocked_id = ?) "+
+		"ON CONFLICT DO NOTHING", message.ID, message.OwnerID, message.OwnerID).Error
+}
+
+// hasLiveGroups check if a message was sent to any live groups
+func hasLiveGroups(db *gorm.DB, messageId uint) (bool, hermesErrors.HermesError) {
+	var count int64
+	result := db.Model(&models.MessageGroup{}).Where("message_id = ?", messageId).Where("live").Count(&count)
+	if result.Error != nil {
+		return false, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message groups: %s\n", result.Error))
+	}
+	return count > 0, nil
+}
+
+// getGroupIds get the groups a message was sent to
+func getGroupIds(db *gorm.DB, messageId uint) ([]uint, hermesErrors.HermesError) {
+	var groupIds []uint
+	result := db.Model(&models.MessageGroup{}).Where("message_id = ?", messageId).Order("group_id").Pluck("group_id", &groupIds)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message groups: %s\n", result.Error))
+	}
+	return groupIds, nil
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// labelError convert an error from saving a label, label names are unique for each user
+func labelError(err error, action string) hermesErrors.HermesError {
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	if err, ok := err.(*pgconn.PgError); ok && err.Code == "23505" {
+		return hermesErrors.LabelExists()
+	}
+	return hermesErrors.InternalServerError(fmt.Sprintf("failed to %s: %s\n", action, err))
+}
+
+// getLabel get a label owned by the user
+func getLabel(db *gorm.DB, labelId int, userId uint) (*models.Label, hermesErrors.HermesError) {
+	var label models.Label
+	result := db.Where("id = ?", labelId).Where("user_id = ?", userId).Limit(1).Find(&label)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get label: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.LabelDoesNotExits()
+	}
+	return &label, nil
+}
+
+// AddLabel create a label or folder for the user
+func AddLabel(db *gorm.DB, label *models.Label, userId uint) (*models.Label, hermesErrors.HermesError) {
+	label.ID = 0
+	label.UserID = userId
+	result := db.Create(label)
+	if result.Error != nil {
+		return nil, labelError(result.Error, "add label")
+	}
+	return label, nil
+}
+
+// GetLabels get the user's labels and folders
+func GetLabels(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	var labels []models.Label
+	result := db.Where("user_id = ?", userId).Order("name").Find(&labels)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get labels: %s\n", result.Error))
+	}
+	return fiber.Map{"labels": labels}, nil
+}
+
+// EditLabel rename a label owned by the user, whether it is a folder can not be changed
+func EditLabel(db *gorm.DB, labelId int, update *models.Label, userId uint) (*models.Label, hermesErrors.HermesError) {
+	label, hermesError := getLabel(db, labelId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	label.Name = update.Name
+	result := db.Model(label).Update("name", label.Name)
+	if result.Error != nil {
+		return nil, labelError(result.Error, "update label")
+	}
+	return label, nil
+}
+
+// DeleteLabel delete a label owned by the user and remove it from every message
+func DeleteLabel(db *gorm.DB, labelId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	result := db.Where("id = ?", labelId).Where("user_id = ?", userId).Delete(&models.Label{})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to delete label: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.LabelDoesNotExits()
+	}
+	return fiber.Map{"result": "label deleted"}, nil
+}
+
+// visibleIds get the messages the user can see out of the ids
+func visibleIds(db *gorm.DB, messageIds []uint, userId uint) ([]uint, hermesErrors.HermesError) {
+	ids := []uint{}
+	result := db.Model(&models.Message{}).Scopes(models.VisibleTo(userId)).Where("messages.id IN ?", messageIds).Order("messages.id").Pluck("messages.id", &ids)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get messages: %s\n", result.Error))
+	}
+	return ids, nil
+}
+
+// applyLabel apply a label to messages the user can see, a folder replaces the user's other folders on the messages
+func applyLabel(tx *gorm.DB, label *models.Label, messageIds []uint) error {
+	if len(messageIds) == 0 {
+		return nil
+	}
+	if label.Folder {
+		folders := tx.Model(&models.Label{}).Select("id").Where("user_id = ?", label.UserID).Where("folder").Where("id <> ?", label.ID)
+		result := tx.Where("message_id IN ?", messageIds).Where("label_id IN (?)", folders).Delete(&models.MessageLabel{})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	labels := make([]models.MessageLabel, len(messageIds))
+	for i, messageId := range messageIds {
+		labels[i] = models.MessageLabel{MessageID: messageId, LabelID: label.ID, UserID: label.UserID}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&labels).Error
+}
+
+// ApplyLabel apply a label owned by the user to each of the messages they can see, messages they can not see are skipped
+func ApplyLabel(db *gorm.DB, labelId int, request *models.LabelRequest, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	label, hermesError := getLabel(db, labelId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	messageIds, hermesError := visibleIds(db, request.MessageIDs, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return applyLabel(tx, label, messageIds)
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to apply label: %s\n", err))
+	}
+	return fiber.Map{"message_ids": messageIds}, nil
+}
+
+// RemoveLabel remove a label owned by the user from each of the messages
+func RemoveLabel(db *gorm.DB, labelId int, request *models.LabelRequest, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	label, hermesError := getLabel(db, labelId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	messageIds := []uint{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		labelled := tx.Model(&models.MessageLabel{}).Where("label_id = ?", label.ID).Where("message_id IN ?", request.MessageIDs)
+		if err := labelled.Order("message_id").Pluck("message_id", &messageIds).Error; err != nil {
+			return err
+		}
+		return tx.Where("label_id = ?", label.ID).Where("message_id IN ?", messageIds).Delete(&models.MessageLabel{}).Error
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to remove label: %s\n", err))
+	}
+	return fiber.Map{"message_ids": messageIds}, nil
+}
+
+// StarMessage star or unstar a message the user can see
+func StarMessage(db *gorm.DB, messageId int, starred bool, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	messageIds, hermesError := visibleIds(db, []uint{uint(messageId)}, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	if len(messageIds) == 0 {
+		return nil, hermesErrors.MessageDoesNotExits()
+	}
+
+	if starred {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Star{MessageID: messageIds[0], UserID: userId})
+		if result.Error != nil {
+			return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to star message: %s\n", result.Error))
+		}
+		return fiber.Map{"result": "message starred"}, nil
+	}
+	result := db.Where("message_id = ?", messageIds[0]).Where("user_id = ?", userId).Delete(&models.Star{})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to unstar message: %s\n", result.Error))
+	}
+	return fiber.Map{"result": "message unstarred"}, nil
+}
+
+// addViewerState add the labels and stars the user has put on the messages
+func addViewerState(db *gorm.DB, messages []models.Message, userId uint) hermesErrors.HermesError {
+	if len(messages) == 0 {
+		return nil
+	}
+	messageIds := make([]uint, len(messages))
+	for i, message := range messages {
+		messageIds[i] = message.ID
+	}
+
+	var labels []models.MessageLabel
+	result := db.Where("user_id = ?", userId).Where("message_id IN ?", messageIds).Order("label_id").Find(&labels)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get message labels: %s\n", result.Error))
+	}
+	var starred []uint
+	result = db.Model(&models.Star{}).Where("user_id = ?", userId).Where("message_id IN ?", messageIds).Pluck("message_id", &starred)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get stars: %s\n", result.Error))
+	}
+
+	labelIds := map[uint][]uint{}
+	for _, label := range labels {
+		labelIds[label.MessageID] = append(labelIds[label.MessageID], label.LabelID)
+	}
+	stars := map[uint]bool{}
+	for _, messageId := range starred {
+		stars[messageId] = true
+	}
+	for i := range messages {
+		messages[i].Labels = labelIds[messages[i].ID]
+		messages[i].Starred = stars[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// resolveMentions find the @username mentions in the text of a message and resolve them to users, mentions of
+// usernames that do not exist are left as text
+func resolveMentions(db *gorm.DB, message *models.Message) hermesErrors.HermesError {
+	entities := models.FindMentions(message.Text)
+	if len(entities) == 0 {
+		message.Mentions = nil
+		return nil
+	}
+
+	usernames := make([]string, len(entities))
+	for i, entity := range entities {
+		usernames[i] = entity.Username
+	}
+	var users []models.User
+	result := db.Select("id", "username").Where("username IN ?", usernames).Find(&users)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get mentioned users: %s\n", result.Error))
+	}
+	userIds := map[string]uint{}
+	for _, user := range users {
+		userIds[user.Username] = user.ID
+	}
+
+	resolved := entities[:0]
+	for _, entity := range entities {
+		if userId, ok := userIds[entity.Username]; ok {
+			entity.UserID = userId
+			resolved = append(resolved, entity)
+		}
+	}
+	message.Mentions = nil
+	if len(resolved) > 0 {
+		message.Mentions = resolved
+	}
+	return nil
+}
+
+// dropMentions remove the mentions of the users from a message, used for recipients dropped because they blocked the
+// owner so the message does not point them out
+func dropMentions(message *models.Message, userIds []uint) {
+	if len(userIds) == 0 {
+		return
+	}
+	dropped := map[uint]bool{}
+	for _, userId := range userIds {
+		dropped[userId] = true
+	}
+	kept := message.Mentions[:0]
+	for _, mention := range message.Mentions {
+		if !dropped[mention.UserID] {
+			kept = append(kept, mention)
+		}
+	}
+	message.Mentions = nil
+	if len(kept) > 0 {
+		message.Mentions = kept
+	}
+}
+
+// mentionedIds the users mentioned in a message other than its owner
+func mentionedIds(message *models.Message) []uint {
+	var userIds []uint
+	for _, mention := range message.Mentions {
+		if mention.UserID != message.OwnerID {
+			userIds = append(userIds, mention.UserID)
+		}
+	}
+	return uniqueIds(userIds)
+}
+
+// checkMentions resolve the mentions in a message and return the mentioned users that are not one of the recipients or
+// a member of one of the message's groups, the message is rejected instead if they are not configured to be added
+func checkMentions(db *gorm.DB, config *models.MentionConfig, message *models.Message, recipientIds []uint) ([]uint, hermesErrors.HermesError) {
+	if hermesError := resolveMentions(db, message); hermesError != nil {
+		return nil, hermesError
+	}
+
+	recipients := map[uint]bool{}
+	for _, recipientId := range recipientIds {
+		recipients[recipientId] = true
+	}
+	var missing []uint
+	for _, userId := range mentionedIds(message) {
+		if !recipients[userId] {
+			missing = append(missing, userId)
+		}
+	}
+
+	//members of the groups get the message so they do not need to be added, unless they blocked the owner and so do not
+	//get it
+	if len(missing) > 0 && len(message.GroupIDs) > 0 {
+		var memberIds []uint
+		result := db.Model(&models.GroupMember{}).Where("group_id IN ?", message.GroupIDs).Where("user_id IN ?", missing).
+			Where("NOT EXISTS (SELECT 1 FROM blocks b WHERE b.user_id = group_members.user_id AND b.blocked_id = ?)", message.OwnerID).Pluck("user_id", &memberIds)
+		if result.Error != nil {
+			return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get group members: %s\n", result.Error))
+		}
+		members := map[uint]bool{}
+		for _, memberId := range memberIds {
+			members[memberId] = true
+		}
+		unreached := missing[:0]
+		for _, userId := range missing {
+			if !members[userId] {
+				unreached = append(unreached, userId)
+			}
+		}
+		missing = unreached
+	}
+
+	if len(missing) > 0 && !config.AddRecipients {
+		return nil, hermesErrors.MentionNotRecipient()
+	}
+	return missing, nil
+}
+
+// saveMentions replace the mentions stored for a message and return the users that were not mentioned before, call
+// inside a transaction
+func saveMentions(tx *gorm.DB, message *models.Message) ([]uint, error) {
+	mentioned := mentionedIds(message)
+
+	var before []uint
+	if err := tx.Model(&models.Mention{}).Where("message_id = ?", message.ID).Pluck("user_id", &before).Error; err != nil {
+		return nil, err
+	}
+	if len(before) > 0 {
+		removed := tx.Where("message_id = ?", message.ID)
+		if len(mentioned) > 0 {
+			removed = removed.Where("user_id NOT IN ?", mentioned)
+		}
+		if err := removed.Delete(&models.Mention{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(mentioned) == 0 {
+		return nil, nil
+	}
+
+	mentions := make([]models.Mention, len(mentioned))
+	for i, userId := range mentioned {
+		mentions[i] = models.Mention{MessageID: message.ID, UserID: userId}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&mentions).Error; err != nil {
+		return nil, err
+	}
+
+	previous := map[uint]bool{}
+	for _, userId := range before {
+		previous[userId] = true
+	}
+	var added []uint
+	for _, userId := range mentioned {
+		if !previous[userId] {
+			added = append(added, userId)
+		}
+	}
+	return added, nil
+}
+
+// recordMentionEvents tell the mentioned users that get the message they were mentioned, users that blocked the owner
+// are not told
+func recordMentionEvents(tx *gorm.DB, messageId uint, userIds []uint) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	recipients, hermesError := recipientIds(tx, messageId)
+	if hermesError != nil {
+		return hermesError
+	}
+	mentioned := map[uint]bool{}
+	for _, userId := range userIds {
+		mentioned[userId] = true
+	}
+	var notified []uint
+	for _, recipientId := range recipients {
+		if mentioned[recipientId] {
+			notified = append(notified, recipientId)
+		}
+	}
+	return recordEvents(tx, models.EventMentioned, messageId, notified)
+}
@@ -5,80 +5,245 @@ import (
 	"fmt"
 	"github.com/Daniel-W-Innes/hermes/hermesErrors"
 	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgconn"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"time"
 )
 
 // AddMessage add a new message and check all word play types
-func AddMessage(db *gorm.DB, message *models.Message, userId uint) (interface{}, hermesErrors.HermesError) {
+func AddMessage(db *gorm.DB, config *models.Config, message *models.Message, userId uint) (interface{}, hermesErrors.HermesError) {
 	// ensure the OwnerID matches the userId from the auth
 	message.OwnerID = userId
 
-	// check all word play types
-	message.Check()
+	// attachments can only be added by uploading them and only forwards have a provenance
+	message.Attachments = nil
+	message.ForwardedFrom = nil
 
-	// create message in db
-	result := db.Clauses(clause.Returning{}).Create(message)
-	if result.Error != nil {
-		for errors.Unwrap(result.Error) != nil {
-			result.Error = errors.Unwrap(result.Error)
-		}
-		switch err := result.Error.(type) {
-		case *pgconn.PgError:
-			if err.Code == "23503" {
-				if err.ConstraintName == "fk_recipients_user" {
-					return nil, hermesErrors.RecipientDoesNotExits()
-				} else {
-					return nil, hermesErrors.OwnerDoesNotExits()
-				}
+	// check all word play types, drafts are checked when they are sent
+	if !message.Draft {
+		message.Check(&config.AnalysisConfig)
+	}
+
+	// convert ttl to an expiry time if requested
+	message.SetExpiry(time.Now())
+
+	// mentioned users must be recipients unless they are configured to be added
+	recipients := make([]uint, len(message.Recipients))
+	for i, recipient := range message.Recipients {
+		recipients[i] = recipient.ID
+	}
+	added, hermesError := checkMentions(db, &config.MentionConfig, message, recipients)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	for _, mentionedId := range added {
+		message.Recipients = append(message.Recipients, models.User{Model: gorm.Model{ID: mentionedId}})
+	}
+
+	return createMessage(db, config, message, userId)
+}
+
+// createMessage create a checked message with its attachments, link it to its groups and send it to the recipients if it
+// is not a draft
+func createMessage(db *gorm.DB, config *models.Config, message *models.Message, userId uint) (interface{}, hermesErrors.HermesError) {
+	// live group members have no recipient row to remove when they view the message, so it could not be viewed once
+	if message.ViewOnce && config.GroupConfig.Live && len(message.GroupIDs) > 0 {
+		return nil, hermesErrors.ViewOnceLiveGroup()
+	}
+
+	// recipients that have blocked the user are checked when the message is sent
+	if !message.Draft {
+		blocked, hermesError := removeBlocked(db, &config.BlockConfig, message)
+		if hermesError != nil {
+			return nil, hermesError
+		}
+		dropMentions(message, blocked)
+	}
+
+	// the user can only send to groups they are a member of
+	message.GroupIDs = uniqueIds(message.GroupIDs)
+	if hermesError := checkGroups(db, message.GroupIDs, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	// anagrams are found in the conversation so they are checked once the recipients are final
+	if !message.Draft {
+		if hermesError := checkAnagram(db, &config.AnalysisConfig, message); hermesError != nil {
+			return nil, hermesError
+		}
+	}
+
+	// create message in db along with its events, the owner always hears about it and recipients only once it is sent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// forwards share the blobs of the original attachments
+		if err := retainBlobs(tx, message.Attachments); err != nil {
+			return err
+		}
+		// recipients are referenced by id so only the join rows are inserted, not the users
+		if err := tx.Clauses(clause.Returning{}).Omit("Recipients.*").Create(message).Error; err != nil {
+			return err
+		}
+		if err := linkGroups(tx, &config.GroupConfig, message.ID, message.GroupIDs); err != nil {
+			return err
+		}
+		if !message.Draft {
+			if err := expandGroups(tx, message); err != nil {
+				return err
+			}
+		}
+		mentioned, err := saveMentions(tx, message)
+		if err != nil {
+			return err
+		}
+		if err := recordEvents(tx, models.EventMessageCreated, message.ID, []uint{userId}); err != nil {
+			return err
+		}
+		if !message.Draft {
+			if err := recordRecipientEvents(tx, message.ID); err != nil {
+				return err
 			}
-		case hermesErrors.HermesError:
-			return nil, err
-		default:
-			return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to add message %s\n", result.Error))
+			return recordMentionEvents(tx, message.ID, mentioned)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, messageSaveError(err, "add")
 	}
+	wakeRelay()
 
 	// return message id for get, delete and edit calls
 	return fiber.Map{"id": message.ID}, nil
 }
 
-// DeleteMessage delete a message by id
-func DeleteMessage(db *gorm.DB, messageId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+// messageSaveError map an error from saving a message, recipients that do not exist violate the foreign key of their
+// join row
+func messageSaveError(err error, action string) hermesErrors.HermesError {
+	var pgError *pgconn.PgError
+	var hermesError hermesErrors.HermesError
+	if errors.As(err, &pgError) && pgError.Code == "23503" {
+		if pgError.ConstraintName == "fk_recipients_user" {
+			return hermesErrors.RecipientDoesNotExits()
+		}
+		return hermesErrors.OwnerDoesNotExits()
+	} else if errors.As(err, &hermesError) {
+		return hermesError
+	}
+	return hermesErrors.InternalServerError(fmt.Sprintf("failed to %s message %s\n", action, err))
+}
+
+// deleteMessage delete a message owned by the user and record the events, call inside a transaction
+func deleteMessage(tx *gorm.DB, messageId int, userId uint) error {
 	// delete the message and specify owner_id prevent from deleting other users message
-	result := db.Where("id = ?", messageId).Where("owner_id = ?", userId).Delete(&models.Message{})
+	result := tx.Scopes(models.NotExpired).Where("id = ?", messageId).Where("owner_id = ?", userId).Delete(&models.Message{})
 	if result.Error != nil {
-		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to delete message: %s\n", result.Error))
+		return result.Error
 	}
 
 	//check if no row were removed
 	if result.RowsAffected == 0 {
-		return nil, hermesErrors.MessageDoesNotExits()
+		return hermesErrors.MessageDoesNotExits()
+	}
+
+	//nobody can get the attachments of a deleted message
+	if err := releaseAttachments(tx, []int{messageId}); err != nil {
+		return err
+	}
+
+	//the recipient rows are kept by the soft delete so everyone who could see the message can be told it is gone
+	message := models.Message{}
+	result = tx.Unscoped().Select("id", "owner_id", "draft").Where("id = ?", messageId).Limit(1).Find(&message)
+	if result.Error != nil {
+		return result.Error
+	}
+	return recordMessageEvents(tx, models.EventMessageDeleted, &message)
+}
+
+// DeleteMessage delete a message by id
+func DeleteMessage(db *gorm.DB, messageId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return deleteMessage(tx, messageId, userId)
+	})
+	if hermesError, ok := err.(hermesErrors.HermesError); ok {
+		return nil, hermesError
+	} else if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to delete message: %s\n", err))
 	}
+	wakeRelay()
 	return fiber.Map{"result": "message deleted"}, nil
 }
 
-// GetMessages get all messages owned by or sent to the user
-func GetMessages(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+// markRead mark the message read by a recipient and tell the owner if it is the first time, call inside a transaction
+func markRead(tx *gorm.DB, message *models.Message, userId uint) error {
+	result := tx.Model(&models.Recipient{}).Where("message_id = ?", message.ID).Where("user_id = ?", userId).Where("read_at IS NULL").Update("read_at", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return recordEvents(tx, models.EventMessageRead, message.ID, []uint{message.OwnerID})
+}
+
+// canSee check if the message is owned by or sent to the user with the same rules as GetMessage
+func canSee(db *gorm.DB, messageId int, userId uint) (bool, hermesErrors.HermesError) {
+	var count int64
+
+	result := db.Model(&models.Message{}).Scopes(models.VisibleTo(userId)).Where("messages.id = ?", messageId).Count(&count)
+	if result.Error != nil {
+		return false, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message: %s\n", result.Error))
+	}
+	return count > 0, nil
+}
+
+// listedMessages sent messages where user is owner or a recipient, drafts are listed separately and messages from muted
+// users are left out if configured
+func listedMessages(db *gorm.DB, config *models.BlockConfig, userId uint, filter *models.MessageFilter) *gorm.DB {
+	query := db.Scopes(models.VisibleTo(userId), filter.Scope(userId)).Where("NOT messages.draft")
+	if config.HideMuted {
+		query = query.Scopes(notMuted(userId))
+	}
+	return query
+}
+
+// GetMessages get all messages owned by or sent to the user, optionally only those matching the filter
+func GetMessages(db *gorm.DB, config *models.Config, userId uint, filter *models.MessageFilter) (fiber.Map, hermesErrors.HermesError) {
 	var messages []models.Message
 
-	//get messages from db where user is owner or a recipient
-	result := db.Joins("LEFT JOIN recipients r ON messages.id = r.message_id").Where("r.user_id = ?", userId).Or("owner_id = ?", userId).Find(&messages)
+	//get sent messages from db where user is owner or a recipient
+	result := listedMessages(db, &config.BlockConfig, userId, filter).Find(&messages)
 	if result.Error != nil {
 		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get messages %s\n", result.Error))
 	}
 
+	if hermesError := flagMuted(db, messages, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	if hermesError := addViewerState(db, messages, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	if hermesError := addReactionCounts(db, messages); hermesError != nil {
+		return nil, hermesError
+	}
+
+	hideViewOnce(messages, userId)
 	return fiber.Map{"messages": messages}, nil
 }
 
+// hideViewOnce clear the content of the view once messages sent to the user in a list
+func hideViewOnce(messages []models.Message, userId uint) {
+	for i := range messages {
+		messages[i].HideViewOnce(userId)
+	}
+}
+
 // GetMessage get a messages owned by user
 func GetMessage(db *gorm.DB, messageId int, userId uint) (*models.Message, hermesErrors.HermesError) {
 	var message models.Message
 
 	//get message from db where user is owner or a recipient
-	result := db.Joins("LEFT JOIN recipients r ON messages.id = r.message_id").Where("id = ?", messageId).Where(db.Where("r.user_id = ?", userId).Or("owner_id = ?", userId)).Limit(1).Find(&message)
+	result := db.Scopes(models.VisibleTo(userId)).Preload("Attachments").Where("id = ?", messageId).Limit(1).Find(&message)
 	if result.Error != nil {
 		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get message: %s\n", result.Error))
 	}
@@ -87,15 +252,60 @@ func GetMessage(db *gorm.DB, messageId int, userId uint) (*models.Message, herme
 	if result.RowsAffected == 0 {
 		return nil, hermesErrors.MessageDoesNotExits()
 	}
+
+	counts, hermesError := reactionCounts(db, []uint{message.ID})
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	message.Reactions = counts[message.ID]
+
+	message.GroupIDs, hermesError = getGroupIds(db, message.ID)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	messages := []models.Message{message}
+	if hermesError = addViewerState(db, messages, userId); hermesError != nil {
+		return nil, hermesError
+	}
+	message = messages[0]
+
+	//tell the owner the first time a recipient gets the message
+	if message.OwnerID != userId {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := markRead(tx, &message, userId); err != nil {
+				return err
+			}
+			if !message.ViewOnce {
+				return nil
+			}
+
+			//remove view once messages for the recipient as they are read, the row lock lets only one request have it
+			result := tx.Where("message_id = ?", message.ID).Where("user_id = ?", userId).Delete(&models.Recipient{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return hermesErrors.MessageDoesNotExits()
+			}
+			return nil
+		})
+		if hermesError, ok := err.(hermesErrors.HermesError); ok {
+			return nil, hermesError
+		} else if err != nil {
+			return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to mark message read: %s\n", err))
+		}
+		wakeRelay()
+	}
 	return &message, nil
 }
 
 // EditMessage update message with user input only if the message is owned by the user
-func EditMessage(db *gorm.DB, updateMessage func(out interface{}) error, messageId int, userId uint) (*models.Message, hermesErrors.HermesError) {
+func EditMessage(db *gorm.DB, config *models.Config, updateMessage func(out interface{}) error, messageId int, userId uint) (*models.Message, hermesErrors.HermesError) {
 	var message models.Message
 
 	//get message from db where user is owner
-	result := db.Where("id = ?", messageId).Where("owner_id = ?", userId).Limit(1).Find(&message)
+	result := db.Scopes(models.NotExpired).Where("id = ?", messageId).Where("owner_id = ?", userId).Limit(1).Find(&message)
 	if result.Error != nil {
 		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to delete message: %s\n", result.Error))
 	}
@@ -103,19 +313,281 @@ func EditMessage(db *gorm.DB, updateMessage func(out interface{}) error, message
 		return nil, hermesErrors.MessageDoesNotExits()
 	}
 
-	//update message using callback to isolate api
+	//update message using callback to isolate api, drafts can only be sent with SendMessage and the provenance of a
+	//forward can not be changed
+	draft, forwardedFrom, text := message.Draft, message.ForwardedFrom, message.Text
+	message.ForwardedFrom = nil
 	if err := updateMessage(&message); err != nil {
 		return nil, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to update message with user input: %s\n", err))
 	}
+	message.Draft, message.ForwardedFrom = draft, forwardedFrom
+
+	//a forward shows the original's text under its provenance so the text must stay the original's
+	if message.ForwardedFrom != nil && message.Text != text {
+		return nil, hermesErrors.ForwardTextEdit()
+	}
+
+	if message.ViewOnce {
+		live, hermesError := hasLiveGroups(db, message.ID)
+		if hermesError != nil {
+			return nil, hermesError
+		} else if live {
+			return nil, hermesErrors.ViewOnceLiveGroup()
+		}
+	}
 
 	//redo check in case text is changed
-	message.Check()
+	if !message.Draft {
+		message.Check(&config.AnalysisConfig)
+	}
+
+	//update expiry time in case a new ttl was provided
+	message.SetExpiry(time.Now())
 
-	//save changes to the db
-	result = db.Save(&message)
+	//mentioned users must already get the message, including recipients that removed it and members of its groups
+	var recipients []uint
+	result = db.Unscoped().Model(&models.Recipient{}).Where("message_id = ?", message.ID).Pluck("user_id", &recipients)
 	if result.Error != nil {
-		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to update message %s\n", result.Error))
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get recipients: %s\n", result.Error))
+	}
+
+	//recipients in the input that did not already get the message are added like mentioned users
+	existing := map[uint]bool{}
+	for _, recipientId := range recipients {
+		existing[recipientId] = true
+	}
+	addedMessage := models.Message{OwnerID: userId}
+	kept := message.Recipients[:0]
+	for _, recipient := range message.Recipients {
+		if existing[recipient.ID] {
+			kept = append(kept, recipient)
+			continue
+		}
+		existing[recipient.ID] = true
+		addedMessage.Recipients = append(addedMessage.Recipients, recipient)
+		recipients = append(recipients, recipient.ID)
+	}
+	groupIds, hermesError := getGroupIds(db, message.ID)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	message.GroupIDs = groupIds
+	added, hermesError := checkMentions(db, &config.MentionConfig, &message, recipients)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	//users added to a sent message are checked for blocks like any other recipient
+	for _, mentionedId := range added {
+		addedMessage.Recipients = append(addedMessage.Recipients, models.User{Model: gorm.Model{ID: mentionedId}})
+	}
+	if !message.Draft {
+		blocked, hermesError := removeBlocked(db, &config.BlockConfig, &addedMessage)
+		if hermesError != nil {
+			return nil, hermesError
+		}
+		dropMentions(&message, blocked)
+	}
+	message.Recipients = append(kept, addedMessage.Recipients...)
+
+	//anagrams are found in the conversation so they are checked once the recipients are final
+	if !message.Draft {
+		if hermesError := checkAnagram(db, &config.AnalysisConfig, &message); hermesError != nil {
+			return nil, hermesError
+		}
+	}
+
+	//save changes to the db, attachments can only be added by uploading them
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Attachments", "Recipients.*").Save(&message).Error; err != nil {
+			return err
+		}
+		mentioned, err := saveMentions(tx, &message)
+		if err != nil {
+			return err
+		}
+		if err := recordMessageEvents(tx, models.EventMessageEdited, &message); err != nil {
+			return err
+		}
+		if !message.Draft {
+			addedIds := make([]uint, len(addedMessage.Recipients))
+			for i, recipient := range addedMessage.Recipients {
+				addedIds[i] = recipient.ID
+			}
+			if err := recordEvents(tx, models.EventRecipientAdded, message.ID, addedIds); err != nil {
+				return err
+			}
+			return recordMentionEvents(tx, message.ID, mentioned)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, messageSaveError(err, "update")
 	}
+	wakeRelay()
 
 	return &message, nil
 }
+
+// searchLimit maximum number of results returned by a search
+const searchLimit = 50
+
+// escapedText sql for the message text with the html special characters escaped
+const escapedText = "replace(replace(replace(replace(messages.text, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '\"', '&quot;')"
+
+// SearchMessages full text search the sent messages owned by or sent to the user, best matches first. Messages from
+// muted users are left out if configured
+func SearchMessages(db *gorm.DB, config *models.Config, query string, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	if query == "" {
+		return nil, hermesErrors.MissingSearchQuery()
+	}
+
+	var results []models.SearchResult
+
+	//websearch_to_tsquery supports quoted phrases, or and negation without failing on bad syntax. The text is html
+	//escaped before the matches are marked so the snippet is safe to render as html, the parser keeps the entities whole
+	search := db.Model(&models.Message{}).Scopes(models.VisibleTo(userId))
+	if config.BlockConfig.HideMuted {
+		search = search.Scopes(notMuted(userId))
+	}
+	result := search.Joins("CROSS JOIN websearch_to_tsquery('english', ?) query", query).
+		Select("messages.*, ts_rank(messages.search, query) AS rank, ts_headline('english', "+escapedText+", query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3') AS snippet").
+		Where("NOT messages.draft").Where("messages.search @@ query").
+		//searching would show the content of view once messages without using them up
+		Where("NOT messages.view_once OR messages.owner_id = ?", userId).
+		Order("rank DESC").Limit(searchLimit).Find(&results)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to search messages %s\n", result.Error))
+	}
+
+	return fiber.Map{"messages": results}, nil
+}
+
+// GetDrafts get all unsent messages owned by the user
+func GetDrafts(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	var messages []models.Message
+
+	result := db.Scopes(models.NotExpired).Where("owner_id = ?", userId).Where("draft = ?", true).Find(&messages)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get drafts %s\n", result.Error))
+	}
+
+	return fiber.Map{"messages": messages}, nil
+}
+
+// SendMessage validate and check a draft owned by the user then send it to its recipients
+func SendMessage(db *gorm.DB, config *models.Config, messageId int, userId uint) (*models.Message, hermesErrors.HermesError) {
+	var message models.Message
+
+	//get draft from db where user is owner
+	result := db.Scopes(models.NotExpired).Preload("Recipients").Where("id = ?", messageId).Where("owner_id = ?", userId).Where("draft = ?", true).Limit(1).Find(&message)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get draft: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.MessageDoesNotExits()
+	}
+
+	//drafts skip validation when they are saved so validate now
+	if hermesError := utils.Validate(&message); hermesError != nil {
+		return nil, hermesError.Wrap("failed to validate draft\n")
+	}
+
+	//check that all recipients still exist
+	if len(message.Recipients) > 0 {
+		recipientIds := make([]uint, len(message.Recipients))
+		for i, recipient := range message.Recipients {
+			recipientIds[i] = recipient.ID
+		}
+		var count int64
+		result = db.Model(&models.User{}).Where("id IN ?", recipientIds).Count(&count)
+		if result.Error != nil {
+			return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get recipients: %s\n", result.Error))
+		}
+		if count != int64(len(recipientIds)) {
+			return nil, hermesErrors.RecipientDoesNotExits()
+		}
+	}
+
+	//recipients may have blocked the user since the draft was saved
+	blocked, hermesError := removeBlocked(db, &config.BlockConfig, &message)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	dropMentions(&message, blocked)
+
+	//check all word play types now that the text is final
+	message.Check(&config.AnalysisConfig)
+	message.Draft = false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(blocked) > 0 {
+			if err := tx.Unscoped().Where("message_id = ?", message.ID).Where("user_id IN ?", blocked).Delete(&models.Recipient{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("message_id = ?", message.ID).Where("user_id IN ?", blocked).Delete(&models.Mention{}).Error; err != nil {
+				return err
+			}
+		}
+		//anagrams are found in the conversation so they are checked once the blocked recipients are removed
+		if hermesError := checkAnagram(tx, &config.AnalysisConfig, &message); hermesError != nil {
+			return hermesError
+		}
+		if err := tx.Omit("Recipients").Save(&message).Error; err != nil {
+			return err
+		}
+		//the members of the groups are found now that the message is sent
+		if err := expandGroups(tx, &message); err != nil {
+			return err
+		}
+		if err := recordRecipientEvents(tx, message.ID); err != nil {
+			return err
+		}
+
+		//tell the users mentioned in the draft now that it is sent
+		var mentioned []uint
+		if err := tx.Model(&models.Mention{}).Where("message_id = ?", message.ID).Pluck("user_id", &mentioned).Error; err != nil {
+			return err
+		}
+		return recordMentionEvents(tx, message.ID, mentioned)
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to send draft %s\n", err))
+	}
+	wakeRelay()
+
+	return &message, nil
+}
+
+// ReapMessages permanently remove all messages that have passed their expiry time
+func ReapMessages(db *gorm.DB) (int64, hermesErrors.HermesError) {
+	var reaped int64
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Message{}).Select("id").Where("expires_at <= ?", now)
+
+		//remove recipients first so the messages are not referenced
+		result := tx.Unscoped().Where("message_id IN (?)", expired).Delete(&models.Recipient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Where("message_id IN (?)", expired).Delete(&models.MessageGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := releaseAttachments(tx, expired); err != nil {
+			return err
+		}
+
+		result = tx.Unscoped().Where("expires_at <= ?", now).Delete(&models.Message{})
+		if result.Error != nil {
+			return result.Error
+		}
+		reaped = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to reap expired messages: %s\n", err))
+	}
+	return reaped, nil
+}
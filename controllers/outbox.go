@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/events"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// outboxWake signals the relay that this instance has recorded events, buffered so waking never blocks
+var outboxWake = make(chan struct{}, 1)
+
+// wakeRelay tell the relay to publish without waiting for its next poll, call after the transaction is committed
+func wakeRelay() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// OutboxWake receives when this instance has recorded events for the relay to publish
+func OutboxWake() <-chan struct{} {
+	return outboxWake
+}
+
+// outboxSinks publish a batch of events inside the relay transaction, an error rolls back the batch so it is published
+// again on the next run
+var outboxSinks = map[string]func(tx *gorm.DB, stored []models.Event) error{
+	models.OutboxSinkWebhook: func(tx *gorm.DB, stored []models.Event) error {
+		if hermesError := queueDeliveries(tx, stored); hermesError != nil {
+			return hermesError
+		}
+		return nil
+	},
+	// notifications are only sent when the transaction commits
+	models.OutboxSinkNotify: func(tx *gorm.DB, stored []models.Event) error {
+		for _, event := range stored {
+			if err := events.Notify(tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	models.OutboxSinkLog: func(_ *gorm.DB, stored []models.Event) error {
+		for _, event := range stored {
+			log.Printf("event %d %s message %d user %d\n", event.ID, event.Type, event.MessageID, event.UserID)
+		}
+		return nil
+	},
+}
+
+// relayLock advisory lock held by the relay transaction so one batch is published at a time on every instance
+const relayLock = 0x6865726d6573
+
+// RelayEvents publish a batch of unpublished events from the outbox to the configured sinks and mark them published.
+// Events are published at least once, a batch is published again if the relay fails before committing, so sinks
+// deduplicate by event id. Every instance can run the relay, batches are published one at a time so the positions
+// given to the events commit in order.
+func RelayEvents(db *gorm.DB, config *models.OutboxConfig) (int, hermesErrors.HermesError) {
+	var stored []models.Event
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", relayLock).Error; err != nil {
+			return err
+		}
+		result := tx.Where("published_at IS NULL").Order("id").Limit(config.BatchSize).Find(&stored)
+		if result.Error != nil || len(stored) == 0 {
+			return result.Error
+		}
+
+		// the positions are given in id order before publishing so the sinks send them to the clients
+		ids := make([]uint, len(stored))
+		for i, event := range stored {
+			ids[i] = event.ID
+		}
+		publishedAt := time.Now()
+		var positions []models.Event
+		err := tx.Raw(fmt.Sprintf(`UPDATE events SET position = ordered.position, published_at = ?
+			FROM (SELECT id, nextval('%s') AS position FROM (SELECT id FROM events WHERE id IN ? ORDER BY id) ids) ordered
+			WHERE events.id = ordered.id RETURNING events.id, events.position`, models.EventPositions), publishedAt, ids).Scan(&positions).Error
+		if err != nil {
+			return err
+		}
+		position := make(map[uint]uint64, len(positions))
+		for _, event := range positions {
+			position[event.ID] = event.Position
+		}
+		for i := range stored {
+			stored[i].Position = position[stored[i].ID]
+			stored[i].PublishedAt = &publishedAt
+		}
+
+		for _, sink := range config.Sinks {
+			if err := outboxSinks[sink](tx, stored); err != nil {
+				return fmt.Errorf("%s sink: %w", sink, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to relay events: %s\n", err))
+	}
+	return len(stored), nil
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/events"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"sync/atomic"
+	"time"
+)
+
+// pollWaiters number of requests waiting for new messages on this instance
+var pollWaiters int64
+
+// newMessageEvent check if the event means a message may have become visible to the user
+func newMessageEvent(event *models.Event) bool {
+	return event.Type == models.EventMessageCreated || event.Type == models.EventRecipientAdded
+}
+
+// newMessages get the listed messages that became visible to the user after the cursor along with the new cursor. The
+// cursor is the position of the user's last published event, so drafts sent after the cursor are found even though they
+// are older. Positions are given in the order events commit, so an event can not be published behind the cursor.
+func newMessages(db *gorm.DB, config *models.BlockConfig, userId uint, since uint64, filter *models.MessageFilter) ([]models.Message, uint64, hermesErrors.HermesError) {
+	cursor := since
+	result := db.Model(&models.Event{}).Select("COALESCE(MAX(position), ?)", since).Where("user_id = ?", userId).Where("position > ?", since).Scan(&cursor)
+	if result.Error != nil {
+		return nil, 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get cursor: %s\n", result.Error))
+	}
+	if cursor == since {
+		return []models.Message{}, cursor, nil
+	}
+
+	newIds := db.Model(&models.Event{}).Select("message_id").
+		Where("user_id = ?", userId).
+		Where("position > ? AND position <= ?", since, cursor).
+		Where("type IN ?", []string{models.EventMessageCreated, models.EventRecipientAdded})
+
+	var messages []models.Message
+	result = listedMessages(db, config, userId, filter).Where("messages.id IN (?)", newIds).Order("messages.id").Find(&messages)
+	if result.Error != nil {
+		return nil, 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get messages %s\n", result.Error))
+	}
+	return messages, cursor, nil
+}
+
+// PollMessages get the messages that became visible to the user after the cursor, if there are none wait up to wait for
+// one to arrive. Waiting requests are woken by the user's live events from the hub and are limited by the config so
+// they can not exhaust the server.
+func PollMessages(db *gorm.DB, config *models.Config, hub *events.Hub, userId uint, since uint64, wait time.Duration, filter *models.MessageFilter) (fiber.Map, hermesErrors.HermesError) {
+	if wait > config.MessageConfig.LongPollMaxWait {
+		wait = config.MessageConfig.LongPollMaxWait
+	}
+
+	var subscription *events.Subscription
+	if wait > 0 {
+		if atomic.AddInt64(&pollWaiters, 1) > int64(config.MessageConfig.LongPollMaxWaiters) {
+			atomic.AddInt64(&pollWaiters, -1)
+			return nil, hermesErrors.TooManyWaiters()
+		}
+		defer atomic.AddInt64(&pollWaiters, -1)
+
+		//subscribe before checking so a message arriving in between is not missed
+		subscription = hub.Subscribe(userId)
+		defer hub.Unsubscribe(subscription)
+	}
+
+	messages, cursor, hermesError := newMessages(db, &config.BlockConfig, userId, since, filter)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	if len(messages) == 0 && subscription != nil {
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+
+		live := subscription.Events
+		for waiting := true; waiting; {
+			select {
+			case event, ok := <-live:
+				if !ok {
+					//dropped by the hub, check once more when the wait is over
+					live = nil
+					continue
+				} else if !newMessageEvent(&event) {
+					continue
+				}
+			case <-timeout.C:
+				waiting = false
+			}
+
+			messages, cursor, hermesError = newMessages(db, &config.BlockConfig, userId, since, filter)
+			if hermesError != nil {
+				return nil, hermesError
+			}
+			if len(messages) > 0 {
+				break
+			}
+		}
+	}
+
+	if hermesError := flagMuted(db, messages, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	if hermesError := addViewerState(db, messages, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	if hermesError := addReactionCounts(db, messages); hermesError != nil {
+		return nil, hermesError
+	}
+
+	hideViewOnce(messages, userId)
+	return fiber.Map{"messages": messages, "cursor": cursor}, nil
+}
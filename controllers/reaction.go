@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reactionCounts get the number of reactions for each emoji on each message
+func reactionCounts(db *gorm.DB, messageIds []uint) (map[uint]map[string]int64, hermesErrors.HermesError) {
+	var rows []struct {
+		MessageID uint
+		Emoji     string
+		Count     int64
+	}
+
+	result := db.Model(&models.Reaction{}).Select("message_id, emoji, count(*) AS count").Where("message_id IN ?", messageIds).Group("message_id, emoji").Scan(&rows)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to count reactions: %s\n", result.Error))
+	}
+
+	counts := map[uint]map[string]int64{}
+	for _, row := range rows {
+		if counts[row.MessageID] == nil {
+			counts[row.MessageID] = map[string]int64{}
+		}
+		counts[row.MessageID][row.Emoji] = row.Count
+	}
+	return counts, nil
+}
+
+// addReactionCounts set the aggregated reactions on each message
+func addReactionCounts(db *gorm.DB, messages []models.Message) hermesErrors.HermesError {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	messageIds := make([]uint, len(messages))
+	for i, message := range messages {
+		messageIds[i] = message.ID
+	}
+
+	counts, hermesError := reactionCounts(db, messageIds)
+	if hermesError != nil {
+		return hermesError
+	}
+	for i := range messages {
+		messages[i].Reactions = counts[messages[i].ID]
+	}
+	return nil
+}
+
+// AddReaction react to a message owned by or sent to the user, reacting twice with the same emoji has no effect
+func AddReaction(db *gorm.DB, reaction *models.Reaction, messageId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	visible, hermesError := canSee(db, messageId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	if !visible {
+		return nil, hermesErrors.MessageDoesNotExits()
+	}
+
+	// ensure the reaction is for the message and user from the request
+	reaction.MessageID = uint(messageId)
+	reaction.UserID = userId
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to add reaction: %s\n", result.Error))
+	}
+
+	return getReactions(db, uint(messageId))
+}
+
+// RemoveReaction remove the user's reaction with the emoji from a message they can see
+func RemoveReaction(db *gorm.DB, emoji string, messageId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	visible, hermesError := canSee(db, messageId, userId)
+	if hermesError != nil {
+		return nil, hermesError
+	}
+	if !visible {
+		return nil, hermesErrors.MessageDoesNotExits()
+	}
+
+	result := db.Where("message_id = ?", messageId).Where("user_id = ?", userId).Where("emoji = ?", emoji).Delete(&models.Reaction{})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to remove reaction: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.ReactionDoesNotExits()
+	}
+
+	return getReactions(db, uint(messageId))
+}
+
+// getReactions get the aggregated reactions of a single message
+func getReactions(db *gorm.DB, messageId uint) (fiber.Map, hermesErrors.HermesError) {
+	counts, hermesError := reactionCounts(db, []uint{messageId})
+	if hermesError != nil {
+		return nil, hermesError
+	}
+
+	reactions := counts[messageId]
+	if reactions == nil {
+		reactions = map[string]int64{}
+	}
+	return fiber.Map{"reactions": reactions}, nil
+}
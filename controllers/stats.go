@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// leaderboardLimit most users returned on one leaderboard
+const leaderboardLimit = 100
+
+// GetStats get the user's palindrome stats as of the last refresh, zero if they had not sent a message by then
+func GetStats(db *gorm.DB, userId uint) (*models.UserStats, hermesErrors.HermesError) {
+	stats := models.UserStats{}
+	result := db.First(&stats, userId)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return &models.UserStats{UserID: userId}, nil
+	} else if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get stats: %s\n", result.Error))
+	}
+	return &stats, nil
+}
+
+// GetLeaderboard get the top users ranked by the statistic
+func GetLeaderboard(db *gorm.DB, by string, limit int) (fiber.Map, hermesErrors.HermesError) {
+	order, ok := models.LeaderboardOrders[by]
+	if !ok {
+		return nil, hermesErrors.InvalidLeaderboardOrder()
+	}
+	if limit > leaderboardLimit {
+		limit = leaderboardLimit
+	}
+
+	var leaderboard []models.UserStats
+	result := db.Order(order).Order("user_id").Limit(limit).Find(&leaderboard)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get leaderboard: %s\n", result.Error))
+	}
+	return fiber.Map{"leaderboard": leaderboard}, nil
+}
+
+// RefreshStats recompute the user stats view without blocking readers
+func RefreshStats(db *gorm.DB) hermesErrors.HermesError {
+	if err := db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY user_stats").Error; err != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to refresh stats: %s\n", err))
+	}
+	return nil
+}
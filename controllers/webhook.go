@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/webhooks"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// deliveryLogLimit most deliveries returned from the delivery log
+	deliveryLogLimit = 100
+	// webhookBatchSize most deliveries sent at once by each instance
+	webhookBatchSize = 50
+)
+
+// isAdmin check if the user is listed in the admin config
+func isAdmin(db *gorm.DB, config *models.AdminConfig, userId uint) (bool, hermesErrors.HermesError) {
+	user := models.User{}
+	result := db.Select("username").Limit(1).Find(&user, userId)
+	if result.Error != nil {
+		return false, hermesErrors.InternalServerError(fmt.Sprintf("failed to get user: %s\n", result.Error))
+	}
+	return result.RowsAffected > 0 && config.IsAdmin(user.Username), nil
+}
+
+// AddWebhook register a webhook for the user, the url must pass the config's checks and only admins can receive every
+// user's events
+func AddWebhook(db *gorm.DB, config *models.Config, webhook *models.Webhook, userId uint) (*models.Webhook, hermesErrors.HermesError) {
+	webhook.UserID = userId
+	ctx, cancel := context.WithTimeout(context.Background(), config.WebhookConfig.Timeout)
+	defer cancel()
+	err := webhooks.CheckURL(ctx, &config.WebhookConfig, webhook.URL)
+	if err == webhooks.ErrSchemeNotAllowed || err == webhooks.ErrAddressNotAllowed {
+		return nil, hermesErrors.WebhookURLNotAllowed(err.Error())
+	} else if err != nil {
+		return nil, hermesErrors.WebhookURLNotAllowed("host could not be resolved")
+	}
+
+	if webhook.AllUsers {
+		admin, hermesError := isAdmin(db, &config.AdminConfig, userId)
+		if hermesError != nil {
+			return nil, hermesError
+		} else if !admin {
+			return nil, hermesErrors.NotAdmin()
+		}
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to generate webhook secret: %s\n", err))
+	}
+	webhook.Secret = secret
+
+	result := db.Create(webhook)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to add webhook: %s\n", result.Error))
+	}
+	return webhook, nil
+}
+
+// GetWebhooks get the user's webhooks without their secrets
+func GetWebhooks(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	var hooks []models.Webhook
+	result := db.Omit("secret").Where("user_id = ?", userId).Find(&hooks)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get webhooks: %s\n", result.Error))
+	}
+	return fiber.Map{"webhooks": hooks}, nil
+}
+
+// DeleteWebhook remove a webhook owned by the user along with its deliveries
+func DeleteWebhook(db *gorm.DB, webhookId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	result := db.Where("id = ?", webhookId).Where("user_id = ?", userId).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to delete webhook: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.WebhookDoesNotExits()
+	}
+	return fiber.Map{"result": "webhook deleted"}, nil
+}
+
+// ownsWebhook check if the webhook is owned by the user
+func ownsWebhook(db *gorm.DB, webhookId int, userId uint) hermesErrors.HermesError {
+	var count int64
+	result := db.Model(&models.Webhook{}).Where("id = ?", webhookId).Where("user_id = ?", userId).Count(&count)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get webhook: %s\n", result.Error))
+	}
+	if count == 0 {
+		return hermesErrors.WebhookDoesNotExits()
+	}
+	return nil
+}
+
+// GetDeliveries get the latest deliveries to a webhook owned by the user, optionally only those with the status
+func GetDeliveries(db *gorm.DB, webhookId int, userId uint, status string) (fiber.Map, hermesErrors.HermesError) {
+	if hermesError := ownsWebhook(db, webhookId, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	query := db.Where("webhook_id = ?", webhookId)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []models.WebhookDelivery
+	result := query.Order("id DESC").Limit(deliveryLogLimit).Find(&deliveries)
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get deliveries: %s\n", result.Error))
+	}
+	return fiber.Map{"deliveries": deliveries}, nil
+}
+
+// RetryDelivery send a dead lettered delivery again with a fresh set of attempts
+func RetryDelivery(db *gorm.DB, webhookId int, deliveryId int, userId uint) (fiber.Map, hermesErrors.HermesError) {
+	if hermesError := ownsWebhook(db, webhookId, userId); hermesError != nil {
+		return nil, hermesError
+	}
+
+	result := db.Model(&models.WebhookDelivery{}).Where("id = ?", deliveryId).Where("webhook_id = ?", webhookId).Where("status = ?", models.DeliveryDead).
+		Updates(map[string]interface{}{"status": models.DeliveryPending, "attempts": 0, "next_attempt_at": time.Now()})
+	if result.Error != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to retry delivery: %s\n", result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return nil, hermesErrors.DeliveryDoesNotExits()
+	}
+	return fiber.Map{"result": "delivery queued"}, nil
+}
+
+// queueDeliveries create a pending delivery of each event for every webhook that wants it, events already queued for a
+// webhook are skipped
+func queueDeliveries(db *gorm.DB, stored []models.Event) hermesErrors.HermesError {
+	userIds := make([]uint, len(stored))
+	for i, event := range stored {
+		userIds[i] = event.UserID
+	}
+
+	var hooks []models.Webhook
+	result := db.Where("user_id IN ? OR all_users", userIds).Find(&hooks)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get webhooks: %s\n", result.Error))
+	}
+
+	var deliveries []models.WebhookDelivery
+	for i := range stored {
+		payload, err := json.Marshal(models.WebhookPayload{
+			EventID:   stored[i].ID,
+			Type:      stored[i].Type,
+			MessageID: stored[i].MessageID,
+			UserID:    stored[i].UserID,
+			CreatedAt: stored[i].CreatedAt,
+		})
+		if err != nil {
+			return hermesErrors.InternalServerError(fmt.Sprintf("failed to marshal webhook payload: %s\n", err))
+		}
+		for j := range hooks {
+			if hooks[j].Wants(&stored[i]) {
+				deliveries = append(deliveries, models.WebhookDelivery{
+					WebhookID:     hooks[j].ID,
+					EventID:       stored[i].ID,
+					Type:          stored[i].Type,
+					Payload:       string(payload),
+					Status:        models.DeliveryPending,
+					NextAttemptAt: stored[i].CreatedAt,
+				})
+			}
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries)
+	if result.Error != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to queue webhook deliveries: %s\n", result.Error))
+	}
+	return nil
+}
+
+// claimDeliveries take the pending deliveries that are due, they are leased by pushing back their next attempt so other
+// instances skip them while they are sent
+func claimDeliveries(db *gorm.DB, config *models.WebhookConfig, now time.Time) ([]models.WebhookDelivery, hermesErrors.HermesError) {
+	var deliveries []models.WebhookDelivery
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", models.DeliveryPending).Where("next_attempt_at <= ?", now).
+			Order("next_attempt_at").Limit(webhookBatchSize).Find(&deliveries)
+		if result.Error != nil || len(deliveries) == 0 {
+			return result.Error
+		}
+
+		ids := make([]uint, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).UpdateColumn("next_attempt_at", now.Add(2*config.Timeout)).Error
+	})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to claim webhook deliveries: %s\n", err))
+	}
+	return deliveries, nil
+}
+
+// DeliverWebhooks send the pending deliveries that are due, failures are retried with exponential backoff until they
+// are dead lettered after the maximum number of attempts. Returns the number of deliveries attempted.
+func DeliverWebhooks(db *gorm.DB, config *models.WebhookConfig, client *http.Client) (int, hermesErrors.HermesError) {
+	now := time.Now()
+	deliveries, hermesError := claimDeliveries(db, config, now)
+	if hermesError != nil || len(deliveries) == 0 {
+		return 0, hermesError
+	}
+
+	webhookIds := make([]uint, len(deliveries))
+	for i, delivery := range deliveries {
+		webhookIds[i] = delivery.WebhookID
+	}
+	var hooks []models.Webhook
+	result := db.Where("id IN ?", webhookIds).Find(&hooks)
+	if result.Error != nil {
+		return 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get webhooks: %s\n", result.Error))
+	}
+	hooksById := map[uint]*models.Webhook{}
+	for i := range hooks {
+		hooksById[hooks[i].ID] = &hooks[i]
+	}
+
+	// send concurrently so one slow receiver does not hold up the batch
+	wait := sync.WaitGroup{}
+	for i := range deliveries {
+		webhook, ok := hooksById[deliveries[i].WebhookID]
+		if !ok {
+			continue
+		}
+		wait.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wait.Done()
+			status, err := webhooks.Send(client, config, webhook, delivery, now)
+			recordAttempt(delivery, config, status, err)
+		}(&deliveries[i])
+	}
+	wait.Wait()
+
+	for i := range deliveries {
+		result = db.Model(&deliveries[i]).Select("status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at").Updates(&deliveries[i])
+		if result.Error != nil {
+			return i, hermesErrors.InternalServerError(fmt.Sprintf("failed to record webhook delivery: %s\n", result.Error))
+		}
+	}
+	return len(deliveries), nil
+}
+
+// recordAttempt update the delivery with the result of an attempt to send it
+func recordAttempt(delivery *models.WebhookDelivery, config *models.WebhookConfig, status int, err error) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = status
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= config.MaxAttempts {
+		delivery.Status = models.DeliveryDead
+	} else {
+		delivery.NextAttemptAt = now.Add(config.RetryAfter(delivery.Attempts))
+	}
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"github.com/Daniel-W-Innes/hermes/models"
+	"sync"
+)
+
+// subscriptionBuffer events held for a slow subscriber before it is dropped
+const subscriptionBuffer = 64
+
+// Subscription live events for one connected client
+type Subscription struct {
+	UserID uint
+	// Events closed if the client falls too far behind, it should reconnect and resume from its last event
+	Events chan models.Event
+}
+
+// Hub fan out events to the clients connected to this instance
+type Hub struct {
+	lock        sync.Mutex
+	subscribers map[uint]map[*Subscription]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[uint]map[*Subscription]bool{}}
+}
+
+var lock = &sync.Mutex{}
+
+var hub *Hub
+
+// GetHub get singleton hub
+func GetHub() *Hub {
+	if hub == nil {
+		lock.Lock()
+		defer lock.Unlock()
+		if hub == nil {
+			hub = NewHub()
+		}
+	}
+	return hub
+}
+
+// Subscribe start receiving the user's events
+func (h *Hub) Subscribe(userId uint) *Subscription {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	subscription := &Subscription{UserID: userId, Events: make(chan models.Event, subscriptionBuffer)}
+	if h.subscribers[userId] == nil {
+		h.subscribers[userId] = map[*Subscription]bool{}
+	}
+	h.subscribers[userId][subscription] = true
+	return subscription
+}
+
+// Unsubscribe stop receiving events, safe to call after the subscription was dropped
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.remove(subscription)
+}
+
+// remove the subscription and close its channel, the lock must be held
+func (h *Hub) remove(subscription *Subscription) {
+	subscriptions := h.subscribers[subscription.UserID]
+	if !subscriptions[subscription] {
+		return
+	}
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(h.subscribers, subscription.UserID)
+	}
+	close(subscription.Events)
+}
+
+// Publish send the event to each of the user's subscriptions without blocking
+func (h *Hub) Publish(event models.Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for subscription := range h.subscribers[event.UserID] {
+		select {
+		case subscription.Events <- event:
+		default:
+			//the event is stored so dropping the subscriber lets it catch up by resuming
+			h.remove(subscription)
+		}
+	}
+}
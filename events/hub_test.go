@@ -0,0 +1,51 @@
+package events
+
+import (
+	"github.com/Daniel-W-Innes/hermes/models"
+	"testing"
+)
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub()
+	subscription := hub.Subscribe(1)
+	other := hub.Subscribe(2)
+	defer hub.Unsubscribe(subscription)
+	defer hub.Unsubscribe(other)
+
+	hub.Publish(models.Event{ID: 1, UserID: 1, Type: models.EventRecipientAdded, MessageID: 1})
+
+	select {
+	case event := <-subscription.Events:
+		if event.ID != 1 {
+			t.Errorf("wrong event %v", event)
+		}
+	default:
+		t.Errorf("event was not delivered")
+	}
+
+	select {
+	case event := <-other.Events:
+		t.Errorf("event delivered to the wrong user %v", event)
+	default:
+	}
+}
+
+func TestHub_PublishSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	subscription := hub.Subscribe(1)
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		hub.Publish(models.Event{ID: uint(i + 1), UserID: 1})
+	}
+
+	count := 0
+	for range subscription.Events {
+		count++
+	}
+	if count != subscriptionBuffer {
+		t.Errorf("slow subscriber should be dropped after %d events, got %d", subscriptionBuffer, count)
+	}
+
+	// unsubscribing after being dropped must not panic
+	hub.Unsubscribe(subscription)
+}
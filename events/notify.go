@@ -0,0 +1,90 @@
+package events
+
+import (
+	"encoding/json"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Channel postgres notification channel message events are published on
+const Channel = "message_events"
+
+const (
+	// MinReconnectInterval wait before the first attempt to reconnect a lost or failed listener, doubled after each
+	// failed attempt up to MaxReconnectInterval
+	MinReconnectInterval = time.Second
+	MaxReconnectInterval = time.Minute
+	// pingInterval how long the listener can be idle before the connection is checked
+	pingInterval = 90 * time.Second
+)
+
+// notification payload of a postgres notification, the user id is not part of the event json
+type notification struct {
+	UserID uint
+	Event  models.Event
+}
+
+func encodeNotification(event models.Event) (string, error) {
+	payload, err := json.Marshal(notification{UserID: event.UserID, Event: event})
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+func decodeNotification(payload string) (models.Event, error) {
+	n := notification{}
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return models.Event{}, err
+	}
+	n.Event.UserID = n.UserID
+	return n.Event, nil
+}
+
+// Notify publish the event to the listeners on every instance, inside a transaction it is only sent on commit
+func Notify(db *gorm.DB, event models.Event) error {
+	payload, err := encodeNotification(event)
+	if err != nil {
+		return err
+	}
+	return db.Exec("SELECT pg_notify(?, ?)", Channel, payload).Error
+}
+
+// Listen publish the events notified by every instance to the hub, the connection is reestablished if it is lost.
+// Events notified while disconnected are not delivered live, clients catch up by resuming from their last event.
+func Listen(config *models.DBConfig, hub *Hub) error {
+	listener := pq.NewListener(config.GetPsqlConn(), MinReconnectInterval, MaxReconnectInterval, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("event listener connection error: %s\n", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			// nil is sent after the connection is reestablished
+			if n == nil {
+				log.Println("event listener reconnected")
+				continue
+			}
+			event, err := decodeNotification(n.Extra)
+			if err != nil {
+				log.Printf("failed to decode event notification: %s\n", err)
+				continue
+			}
+			hub.Publish(event)
+		case <-time.After(pingInterval):
+			go func() {
+				_ = listener.Ping()
+			}()
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"github.com/Daniel-W-Innes/hermes/models"
+	"testing"
+	"time"
+)
+
+func TestNotification(t *testing.T) {
+	event := models.Event{
+		ID:        1,
+		CreatedAt: time.Date(2021, time.November, 1, 0, 0, 0, 0, time.UTC),
+		UserID:    2,
+		Type:      models.EventMessageEdited,
+		MessageID: 3,
+	}
+
+	payload, err := encodeNotification(event)
+	if err != nil {
+		t.Fatalf("failed to encode notification %s", err)
+	}
+
+	decoded, err := decodeNotification(payload)
+	if err != nil {
+		t.Fatalf("failed to decode notification %s", err)
+	} else if !decoded.CreatedAt.Equal(event.CreatedAt) || decoded.ID != event.ID || decoded.UserID != event.UserID ||
+		decoded.Type != event.Type || decoded.MessageID != event.MessageID {
+		t.Errorf("event changed in the notification expected %v actual %v", event, decoded)
+	}
+}
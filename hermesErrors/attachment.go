@@ -0,0 +1,30 @@
+package hermesErrors
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+)
+
+func AttachmentDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "attachment does not exits or token can not see the message"),
+	}
+}
+
+func AttachmentTooLarge(maxSize int64) *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("attachment is larger than %d bytes", maxSize)),
+	}
+}
+
+func AttachmentTypeNotAllowed(contentType string) *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusUnsupportedMediaType, fmt.Sprintf("attachment type %s is not allowed", contentType)),
+	}
+}
+
+func ViewOnceAttachment() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusForbidden, "attachments of view once messages can only be downloaded by the owner"),
+	}
+}
@@ -0,0 +1,21 @@
+package hermesErrors
+
+import "github.com/gofiber/fiber/v2"
+
+func RecipientBlocked() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusForbidden, "a recipient has blocked the sender"),
+	}
+}
+
+func UserDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "user does not exits"),
+	}
+}
+
+func BlockSelf() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "users can not block or mute themselves"),
+	}
+}
@@ -10,6 +10,7 @@ type HermesError interface {
 	LogPrivate()
 	privateMessage() string
 	Wrap(s string) *BaseError
+	StatusCode() int
 }
 
 type BaseError struct {
@@ -31,6 +32,11 @@ func (b *BaseError) privateMessage() string {
 	return b.PrivateMessage
 }
 
+// StatusCode the http status the error is returned with
+func (b *BaseError) StatusCode() int {
+	return b.fiberError.Code
+}
+
 func (b *BaseError) Wrap(s string) *BaseError {
 	b.PrivateMessage += s
 	return b
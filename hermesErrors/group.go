@@ -0,0 +1,27 @@
+package hermesErrors
+
+import "github.com/gofiber/fiber/v2"
+
+func GroupDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "group does not exits or token is not a member"),
+	}
+}
+
+func NotGroupAdmin() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusForbidden, "user is not an admin of the group"),
+	}
+}
+
+func MemberDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "member does not exits"),
+	}
+}
+
+func GroupOwnerChange() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "the group owner is always an admin and can not be removed"),
+	}
+}
@@ -0,0 +1,21 @@
+package hermesErrors
+
+import "github.com/gofiber/fiber/v2"
+
+func LabelDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "label does not exits or token is not the owner"),
+	}
+}
+
+func LabelExists() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "label with that name already exists"),
+	}
+}
+
+func ArchiveNameTaken() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "a label that is not a folder has the archive folder's name, rename it to archive messages"),
+	}
+}
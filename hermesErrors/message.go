@@ -19,3 +19,45 @@ func OwnerDoesNotExits() *BaseError {
 		fiberError: fiber.NewError(fiber.StatusBadRequest, "message owner does not exits this should not be possible"),
 	}
 }
+
+func MissingSearchQuery() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "missing search query"),
+	}
+}
+
+func BackfillDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "no backfill has been started"),
+	}
+}
+
+func TooManyWaiters() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusServiceUnavailable, "too many clients are waiting for messages, try again later"),
+	}
+}
+
+func ViewOnceForward() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusForbidden, "view once messages can not be forwarded"),
+	}
+}
+
+func ForwardTextEdit() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusForbidden, "the text of a forwarded message can not be edited"),
+	}
+}
+
+func ViewOnceLiveGroup() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "view once messages can not be sent to live groups"),
+	}
+}
+
+func MentionNotRecipient() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "mentioned user is not a recipient of the message"),
+	}
+}
@@ -0,0 +1,9 @@
+package hermesErrors
+
+import "github.com/gofiber/fiber/v2"
+
+func ReactionDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "reaction does not exits"),
+	}
+}
@@ -0,0 +1,9 @@
+package hermesErrors
+
+import "github.com/gofiber/fiber/v2"
+
+func InvalidLeaderboardOrder() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "leaderboard can not be ordered by that statistic"),
+	}
+}
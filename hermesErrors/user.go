@@ -13,3 +13,9 @@ func UserExists() *BaseError {
 		fiberError: fiber.NewError(fiber.StatusBadRequest, "user already exists"),
 	}
 }
+
+func NotAdmin() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusForbidden, "user is not an admin"),
+	}
+}
@@ -0,0 +1,21 @@
+package hermesErrors
+
+import "github.com/gofiber/fiber/v2"
+
+func WebhookDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "webhook does not exits or token is not the owner"),
+	}
+}
+
+func DeliveryDoesNotExits() *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusNotFound, "dead webhook delivery does not exits"),
+	}
+}
+
+func WebhookURLNotAllowed(reason string) *BaseError {
+	return &BaseError{
+		fiberError: fiber.NewError(fiber.StatusBadRequest, "webhook url is not allowed: "+reason),
+	}
+}
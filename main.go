@@ -1,11 +1,19 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/events"
 	"github.com/Daniel-W-Innes/hermes/models"
 	"github.com/Daniel-W-Innes/hermes/routes"
+	"github.com/Daniel-W-Innes/hermes/storage"
 	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/Daniel-W-Innes/hermes/webhooks"
 	"github.com/gofiber/fiber/v2"
 	"log"
+	"os"
+	"time"
 )
 
 func health(c *fiber.Ctx) error {
@@ -17,20 +25,237 @@ func initDB(config *models.DBConfig) error {
 	if hermesError != nil {
 		return hermesError
 	}
-	err := db.AutoMigrate(&models.Message{}, &models.User{})
+	// the stats view depends on the messages columns so an outdated view is dropped for the migration and recreated after
+	var statsVersion string
+	err := db.Raw(models.UserStatsViewVersion).Scan(&statsVersion).Error
 	if err != nil {
 		return err
 	}
+	if statsVersion != models.UserStatsVersion {
+		err = db.Exec(models.DropUserStatsView).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = db.AutoMigrate(&models.Message{}, &models.User{}, &models.Recipient{}, &models.Attachment{}, &models.Reaction{}, &models.BackfillJob{}, &models.Event{},
+		&models.Webhook{}, &models.WebhookDelivery{}, &models.Group{}, &models.GroupMember{}, &models.MessageGroup{}, &models.GroupAudit{},
+		&models.Block{}, &models.Mute{}, &models.Label{}, &models.MessageLabel{}, &models.Star{}, &models.Mention{}, &models.Blob{},
+		&models.EventTicket{})
+	if err != nil {
+		return err
+	}
+
+	err = db.Exec(fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s", models.EventPositions)).Error
+	if err != nil {
+		return err
+	}
+
+	// the full text search column is generated by postgres so it is not part of the model
+	err = db.Exec("ALTER TABLE messages ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (to_tsvector('english', coalesce(text, ''))) STORED").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_search ON messages USING GIN (search)").Error
+	if err != nil {
+		return err
+	}
+	// filtering by word play results uses json containment on the analysis
+	err = db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_analysis ON messages USING GIN (analysis)").Error
+	if err != nil {
+		return err
+	}
+
+	// stats are served from a materialised view so requests do not aggregate the messages table
+	err = db.Exec(models.UserStatsView).Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec(models.CommentUserStatsView).Error
+	if err != nil {
+		return err
+	}
+	// refreshing concurrently needs a unique index
+	err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_stats_user_id ON user_stats (user_id)").Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// reapMessages periodically remove expired messages, old events and unreferenced blobs
+func reapMessages(config *models.Config) {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return
+	}
+	store, err := storage.GetBlobStore(&config.AttachmentConfig.BlobStore)
+	if err != nil {
+		log.Printf("failed to get blob store %s\n", err)
+		return
+	}
+	for range time.Tick(config.MessageConfig.ReaperInterval) {
+		reaped, hermesError := controllers.ReapMessages(db)
+		if hermesError != nil {
+			hermesError.LogPrivate()
+		} else if reaped > 0 {
+			log.Printf("reaped %d expired messages\n", reaped)
+		}
+
+		reaped, hermesError = controllers.ReapEvents(db, config.EventConfig.Retention)
+		if hermesError != nil {
+			hermesError.LogPrivate()
+		} else if reaped > 0 {
+			log.Printf("reaped %d old events\n", reaped)
+		}
+
+		reaped, hermesError = controllers.ReapBlobs(db, store)
+		if hermesError != nil {
+			hermesError.LogPrivate()
+		} else if reaped > 0 {
+			log.Printf("reaped %d unreferenced blobs\n", reaped)
+		}
+	}
+}
+
+// refreshStats periodically recompute the user stats view
+func refreshStats(config *models.Config) {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return
+	}
+	for range time.Tick(config.StatsConfig.RefreshInterval) {
+		if hermesError := controllers.RefreshStats(db); hermesError != nil {
+			hermesError.LogPrivate()
+		}
+	}
+}
+
+// backfill run the analysis backfill until it is finished, an unfinished job is resumed before starting a new one
+func backfill(config *models.Config, request *models.BackfillRequest) error {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		return hermesError
+	}
+	job, hermesError := controllers.StartBackfill(db, request)
+	if hermesError != nil {
+		return hermesError
+	}
+	log.Printf("running backfill %d over %d messages\n", job.ID, job.Total)
+	if _, hermesError = controllers.RunBackfill(db, config, job.ID); hermesError != nil {
+		return hermesError
+	}
 	return nil
 }
 
+// resumeBackfill continue a backfill that was interrupted when the server stopped
+func resumeBackfill(config *models.Config) {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return
+	}
+	job, hermesError := controllers.GetBackfill(db)
+	if hermesError != nil || job.FinishedAt != nil {
+		return
+	}
+	log.Printf("resuming backfill %d after message %d\n", job.ID, job.Cursor)
+	if _, hermesError = controllers.RunBackfill(db, config, job.ID); hermesError != nil {
+		hermesError.LogPrivate()
+	}
+}
+
+// deliverWebhooks periodically send the pending webhook deliveries that are due
+func deliverWebhooks(config *models.Config) {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return
+	}
+	client := webhooks.NewClient(&config.WebhookConfig)
+	for range time.Tick(config.WebhookConfig.PollInterval) {
+		// keep going while there are full batches so a backlog is cleared without waiting for the next tick
+		for {
+			delivered, hermesError := controllers.DeliverWebhooks(db, &config.WebhookConfig, client)
+			if hermesError != nil {
+				hermesError.LogPrivate()
+				break
+			} else if delivered == 0 {
+				break
+			}
+		}
+	}
+}
+
+// relayEvents publish the events recorded in the outbox, woken straight away when this instance records events and
+// polling for the events recorded by other instances or left behind by a failed run
+func relayEvents(config *models.Config) {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return
+	}
+	ticker := time.NewTicker(config.OutboxConfig.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-controllers.OutboxWake():
+		}
+		for {
+			relayed, hermesError := controllers.RelayEvents(db, &config.OutboxConfig)
+			if hermesError != nil {
+				hermesError.LogPrivate()
+				break
+			} else if relayed == 0 {
+				break
+			}
+		}
+	}
+}
+
+// listenEvents push the events notified by every instance to the clients connected to this one, if listening fails it
+// is retried with backoff so the instance does not go without live events until it is restarted
+func listenEvents(config *models.Config) {
+	wait := events.MinReconnectInterval
+	for {
+		err := events.Listen(&config.DBConfig, events.GetHub())
+		log.Printf("failed to listen for events, retrying in %s: %s\n", wait, err)
+		time.Sleep(wait)
+		if wait *= 2; wait > events.MaxReconnectInterval {
+			wait = events.MaxReconnectInterval
+		}
+	}
+}
+
 func getApp() *fiber.App {
-	app := fiber.New()
+	config, err := models.GetConfig()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// allow bodies large enough for the biggest attachment and its multipart framing
+	bodyLimit := fiber.DefaultBodyLimit
+	if limit := int(config.AttachmentConfig.MaxSize) + 1024*1024; limit > bodyLimit {
+		bodyLimit = limit
+	}
+	app := fiber.New(fiber.Config{BodyLimit: bodyLimit})
 
 	app.Get("/", health)
 
 	routes.User(app)
 	routes.Message(app)
+	routes.Attachment(app)
+	routes.Reaction(app)
+	routes.Analyze(app, config)
+	routes.Stats(app)
+	routes.Admin(app)
+	routes.Webhook(app)
+	routes.Group(app)
+	routes.Block(app)
+	routes.Label(app)
 	return app
 }
 
@@ -45,6 +270,24 @@ func main() {
 		log.Panic(err)
 	}
 
+	// hermes backfill [-all] re-analyses stored messages then exits
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+		all := flags.Bool("all", false, "re-analyse messages already at the current analysis version")
+		_ = flags.Parse(os.Args[2:])
+		if err = backfill(config, &models.BackfillRequest{All: *all}); err != nil {
+			log.Panic(err)
+		}
+		return
+	}
+
+	go reapMessages(config)
+	go refreshStats(config)
+	go resumeBackfill(config)
+	go listenEvents(config)
+	go relayEvents(config)
+	go deliverWebhooks(config)
+
 	err = getApp().Listen(":8080")
 	if err != nil {
 		log.Panic(err)
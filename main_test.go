@@ -1,17 +1,28 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/events"
 	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/storage"
 	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/Daniel-W-Innes/hermes/webhooks"
+	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,9 +37,28 @@ func cleanDB(config *models.DBConfig) error {
 	if err != nil {
 		return err
 	}
+	db.Exec("TRUNCATE TABLE reactions RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE attachments RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE blobs RESTART IDENTITY CASCADE")
 	db.Exec("TRUNCATE TABLE recipients RESTART IDENTITY CASCADE")
 	db.Exec("TRUNCATE TABLE messages RESTART IDENTITY CASCADE")
 	db.Exec("TRUNCATE TABLE users RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE backfill_jobs RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE events RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE event_tickets RESTART IDENTITY CASCADE")
+	db.Exec(fmt.Sprintf("ALTER SEQUENCE %s RESTART", models.EventPositions))
+	db.Exec("TRUNCATE TABLE webhook_deliveries RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE webhooks RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE message_groups RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE group_members RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE groups RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE group_audits RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE blocks RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE mutes RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE message_labels RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE labels RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE stars RESTART IDENTITY CASCADE")
+	db.Exec("TRUNCATE TABLE mentions RESTART IDENTITY CASCADE")
 	return nil
 }
 
@@ -85,8 +115,25 @@ func assertJwtBody(t *testing.T, resp *http.Response) {
 	}
 }
 
+// testAnalysis word play results of the test messages with the default analyzers
+var testAnalysis = models.Analysis{
+	"anagram":               {Result: false, Details: map[string]interface{}{"message_ids": []interface{}{}}},
+	"isogram":               {Result: false, Details: map[string]interface{}{"repeated": "t"}},
+	"lipogram":              {Result: false, Details: map[string]interface{}{"letter": "e"}},
+	"palindrome":            {Result: false},
+	"palindrome_normalised": {Result: false},
+	"pangram":               {Result: false, Details: map[string]interface{}{"missing": "abcdfghijklmnopqruvwxyz"}},
+	"semordnilap":           {Result: false},
+	"sentence_palindrome":   {Result: false},
+	"word_palindrome":       {Result: false},
+}
+
 func addUser(t *testing.T, app *fiber.App) *http.Response {
-	reqBodyBytes, err := json.Marshal(userLogin)
+	return addUserLogin(t, app, userLogin)
+}
+
+func addUserLogin(t *testing.T, app *fiber.App, login models.UserLogin) *http.Response {
+	reqBodyBytes, err := json.Marshal(login)
 	if err != nil {
 		t.Log(fmt.Errorf("failed to marshal body %w", err))
 		t.FailNow()
@@ -187,6 +234,15 @@ func addMessage(t *testing.T, app *fiber.App, token string, message map[string]i
 	return resp
 }
 
+// mustAddMessage add a message that must be accepted
+func mustAddMessage(t *testing.T, app *fiber.App, token string, message map[string]interface{}) {
+	if resp := addMessage(t, app, token, message); resp.StatusCode != fiber.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		t.Logf("failed to add message %v: %s %s", message, resp.Status, string(b))
+		t.FailNow()
+	}
+}
+
 func TestAddMessage(t *testing.T) {
 	app := getApp()
 
@@ -268,7 +324,7 @@ func TestGetMessage(t *testing.T) {
 	resp := addUser(t, app)
 	token := getJwtFromResp(t, resp)
 
-	_ = addMessage(t, app, token, map[string]interface{}{"text": "test"})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
 
 	req := httptest.NewRequest("GET", "/message/1", nil)
 	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
@@ -295,10 +351,12 @@ func TestGetMessage(t *testing.T) {
 			t.FailNow()
 		} else {
 			if !reflect.DeepEqual(models.Message{
-				ID:         1,
-				OwnerID:    1,
-				Text:       "test",
-				Palindrome: false,
+				ID:              1,
+				OwnerID:         1,
+				Text:            "test",
+				Palindrome:      false,
+				Analysis:        testAnalysis,
+				AnalysisVersion: 2,
 			}, message) {
 				t.Logf("the message is not the same %s", message.Text)
 				t.FailNow()
@@ -324,7 +382,7 @@ func TestGetMessages(t *testing.T) {
 	numberMessage := 2
 
 	for i := 1; i <= numberMessage; i++ {
-		_ = addMessage(t, app, token, map[string]interface{}{"text": fmt.Sprintf("test%d", i)})
+		mustAddMessage(t, app, token, map[string]interface{}{"text": fmt.Sprintf("test%d", i)})
 	}
 
 	req := httptest.NewRequest("GET", "/message", nil)
@@ -360,10 +418,12 @@ func TestGetMessages(t *testing.T) {
 			}
 			for i := 1; i <= numberMessage; i++ {
 				expected := models.Message{
-					ID:         uint(i),
-					OwnerID:    1,
-					Text:       fmt.Sprintf("test%d", i),
-					Palindrome: false,
+					ID:              uint(i),
+					OwnerID:         1,
+					Text:            fmt.Sprintf("test%d", i),
+					Palindrome:      false,
+					Analysis:        testAnalysis,
+					AnalysisVersion: 2,
 				}
 				if !reflect.DeepEqual(expected, actual[uint(i)]) {
 					t.Logf("the message is not the same expected %v actual %v", expected, actual[uint(i)])
@@ -374,6 +434,108 @@ func TestGetMessages(t *testing.T) {
 	}
 }
 
+func pollMessages(t *testing.T, app *fiber.App, token string, query string) (messages []models.Message, cursor uint64) {
+	req := httptest.NewRequest("GET", "/message?"+query, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err := app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var body struct {
+			Messages []models.Message
+			Cursor   uint64
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &body); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		}
+		messages, cursor = body.Messages, body.Cursor
+	}
+	return messages, cursor
+}
+
+func TestPollMessages(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
+	publishEvents(t, config)
+
+	messages, cursor := pollMessages(t, app, token, "since=0")
+	if len(messages) != 1 || messages[0].Text != "test" || cursor == 0 {
+		t.Logf("wrong new messages %v cursor %d", messages, cursor)
+		t.FailNow()
+	}
+
+	// nothing new arrives so the request waits out the timeout and keeps the cursor
+	start := time.Now()
+	messages, next := pollMessages(t, app, token, fmt.Sprintf("since=%d&wait=200ms", cursor))
+	if len(messages) != 0 || next != cursor {
+		t.Logf("wrong new messages %v cursor %d", messages, next)
+		t.FailNow()
+	} else if time.Since(start) < 200*time.Millisecond {
+		t.Logf("request did not wait")
+		t.FailNow()
+	}
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+
+	// a message sent while the request is waiting wakes it once its event is published
+	sent := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if resp := addMessage(t, app, token, map[string]interface{}{"text": "later"}); resp.StatusCode != fiber.StatusOK {
+			sent <- fmt.Errorf("bad status: %s", resp.Status)
+			return
+		}
+		if _, hermesError := controllers.RelayEvents(db, &config.OutboxConfig); hermesError != nil {
+			sent <- hermesError
+			return
+		}
+		stored, hermesError := controllers.GetEvents(db, 1, cursor)
+		for _, event := range stored {
+			events.GetHub().Publish(event)
+		}
+		sent <- hermesError
+	}()
+
+	start = time.Now()
+	messages, next = pollMessages(t, app, token, fmt.Sprintf("since=%d&wait=10s", cursor))
+	if err = <-sent; err != nil {
+		t.Logf("failed to send message %s", err)
+		t.FailNow()
+	} else if len(messages) != 1 || messages[0].Text != "later" || next <= cursor {
+		t.Logf("wrong new messages %v cursor %d", messages, next)
+		t.FailNow()
+	} else if time.Since(start) >= 10*time.Second {
+		t.Logf("request was not woken")
+		t.FailNow()
+	}
+}
+
 func TestDeleteMessage(t *testing.T) {
 	app := getApp()
 
@@ -388,7 +550,7 @@ func TestDeleteMessage(t *testing.T) {
 	resp := addUser(t, app)
 	token := getJwtFromResp(t, resp)
 
-	_ = addMessage(t, app, token, map[string]interface{}{"text": "test"})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
 
 	req := httptest.NewRequest("DELETE", "/message/1", nil)
 	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
@@ -438,7 +600,7 @@ func TestEditMessage(t *testing.T) {
 	resp := addUser(t, app)
 	token := getJwtFromResp(t, resp)
 
-	_ = addMessage(t, app, token, map[string]interface{}{"text": "test"})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
 
 	reqBodyBytes, err := json.Marshal(map[string]interface{}{"text": "test update"})
 	if err != nil {
@@ -475,6 +637,18 @@ func TestEditMessage(t *testing.T) {
 				OwnerID:    1,
 				Text:       "test update",
 				Palindrome: false,
+				Analysis: models.Analysis{
+					"anagram":               {Result: false, Details: map[string]interface{}{"message_ids": []interface{}{}}},
+					"isogram":               {Result: false, Details: map[string]interface{}{"repeated": "te"}},
+					"lipogram":              {Result: false, Details: map[string]interface{}{"letter": "e"}},
+					"palindrome":            {Result: false},
+					"palindrome_normalised": {Result: false},
+					"pangram":               {Result: false, Details: map[string]interface{}{"missing": "bcfghijklmnoqrvwxyz"}},
+					"semordnilap":           {Result: false},
+					"sentence_palindrome":   {Result: false},
+					"word_palindrome":       {Result: false},
+				},
+				AnalysisVersion: 2,
 			}, message) {
 				t.Logf("the message is not the same %s", message.Text)
 				t.FailNow()
@@ -508,3 +682,1524 @@ func TestEditMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestSendDraft(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test", "draft": true})
+
+	req := httptest.NewRequest("GET", "/message", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else {
+		var messages map[string][]models.Message
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &messages); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		} else if len(messages["messages"]) != 0 {
+			t.Logf("draft should not be in messages %s", string(b))
+			t.FailNow()
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/message/1/send", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var message models.Message
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &message); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		} else if message.Draft || message.Text != "test" {
+			t.Logf("the message was not sent %s", string(b))
+			t.FailNow()
+		}
+	}
+}
+
+func TestAddReaction(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
+
+	reqBodyBytes, err := json.Marshal(map[string]interface{}{"emoji": "👍"})
+	if err != nil {
+		t.Log(fmt.Errorf("failed to marshal body %w", err))
+		t.FailNow()
+	}
+
+	req := httptest.NewRequest("POST", "/message/1/reaction", bytes.NewReader(reqBodyBytes))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	}
+
+	req = httptest.NewRequest("GET", "/message/1", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var message models.Message
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &message); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		} else if !reflect.DeepEqual(map[string]int64{"👍": 1}, message.Reactions) {
+			t.Logf("the reactions are not the same %v", message.Reactions)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "hello world"})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "goodbye"})
+
+	req := httptest.NewRequest("GET", "/message/search?q=hello", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var messages map[string][]models.SearchResult
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &messages); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		} else if len(messages["messages"]) != 1 {
+			t.Logf("wrong number of messages in body %s", string(b))
+			t.FailNow()
+		} else if messages["messages"][0].ID != 1 || messages["messages"][0].Snippet != "<mark>hello</mark> world" {
+			t.Logf("the search result is not the same %s", string(b))
+			t.FailNow()
+		}
+	}
+
+	// the text is escaped before the match is marked
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "<b>escaped</b> & done"})
+	var messages map[string][]models.SearchResult
+	jsonRequest(t, app, token, "GET", "/message/search?q=escaped", nil, &messages)
+	if len(messages["messages"]) != 1 || messages["messages"][0].Snippet != "&lt;b&gt;<mark>escaped</mark>&lt;/b&gt; &amp; done" {
+		t.Logf("the search result is not escaped %v", messages["messages"])
+		t.FailNow()
+	}
+
+	// view once messages can not be searched by their recipients
+	resp = addUserLogin(t, app, models.UserLogin{Username: "recipient", Password: "password"})
+	recipientToken := getJwtFromResp(t, resp)
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "secret", "ViewOnce": true, "Recipients": []map[string]interface{}{{"ID": 2}}})
+	jsonRequest(t, app, recipientToken, "GET", "/message/search?q=secret", nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("view once message was searched %v", messages["messages"])
+		t.FailNow()
+	}
+	jsonRequest(t, app, token, "GET", "/message/search?q=secret", nil, &messages)
+	if len(messages["messages"]) != 1 {
+		t.Logf("owner could not search view once message %v", messages["messages"])
+		t.FailNow()
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	for _, text := range []string{"racecar", "test", "abba", "noon"} {
+		mustAddMessage(t, app, token, map[string]interface{}{"text": text})
+	}
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+	if hermesError = controllers.RefreshStats(db); hermesError != nil {
+		t.Logf("failed to refresh stats %s", hermesError)
+		t.FailNow()
+	}
+
+	req := httptest.NewRequest("GET", "/stats/me", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var stats models.UserStats
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &stats); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		}
+
+		expected := models.UserStats{
+			UserID:            1,
+			Username:          userLogin.Username,
+			Messages:          4,
+			Palindromes:       3,
+			Ratio:             0.75,
+			LongestPalindrome: 7,
+			CurrentStreak:     2,
+			LongestStreak:     2,
+		}
+		if !reflect.DeepEqual(expected, stats) {
+			t.Logf("the stats are not the same %v", stats)
+			t.FailNow()
+		}
+	}
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "other", Password: "password"})
+	otherToken := getJwtFromResp(t, resp)
+
+	for _, text := range []string{"racecar", "test"} {
+		mustAddMessage(t, app, token, map[string]interface{}{"text": text})
+	}
+	for _, text := range []string{"abba", "noon", "kayak"} {
+		mustAddMessage(t, app, otherToken, map[string]interface{}{"text": text, "TTL": 3600})
+	}
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+	// expired messages are not counted even before they are reaped
+	db.Model(&models.Message{}).Where("text = ?", "kayak").Update("expires_at", time.Now().Add(-time.Minute))
+	if hermesError = controllers.RefreshStats(db); hermesError != nil {
+		t.Logf("failed to refresh stats %s", hermesError)
+		t.FailNow()
+	}
+
+	var leaderboard map[string][]models.UserStats
+	jsonRequest(t, app, token, "GET", "/stats/leaderboard?by=palindromes", nil, &leaderboard)
+	expected := []models.UserStats{
+		{UserID: 2, Username: "other", Messages: 2, Palindromes: 2, Ratio: 1, LongestPalindrome: 4, CurrentStreak: 2, LongestStreak: 2},
+		{UserID: 1, Username: userLogin.Username, Messages: 2, Palindromes: 1, Ratio: 0.5, LongestPalindrome: 7, CurrentStreak: 0, LongestStreak: 1},
+	}
+	if !reflect.DeepEqual(expected, leaderboard["leaderboard"]) {
+		t.Logf("the leaderboard is not the same %v", leaderboard["leaderboard"])
+		t.FailNow()
+	}
+
+	jsonRequest(t, app, token, "GET", "/stats/leaderboard?by=longest_palindrome&limit=1", nil, &leaderboard)
+	if len(leaderboard["leaderboard"]) != 1 || leaderboard["leaderboard"][0].UserID != 1 {
+		t.Logf("the leaderboard is not ordered by longest palindrome %v", leaderboard["leaderboard"])
+		t.FailNow()
+	}
+
+	if resp = authRequest(t, app, token, "GET", "/stats/leaderboard?by=text", nil); resp.StatusCode != fiber.StatusBadRequest {
+		t.Logf("leaderboard ordered by an unknown statistic %s", resp.Status)
+		t.FailNow()
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "racecar"})
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+
+	// make the stored analysis stale as if it was from an older version
+	result := db.Model(&models.Message{}).Where("id = ?", 1).UpdateColumns(map[string]interface{}{"palindrome": false, "analysis_version": 0})
+	if result.Error != nil {
+		t.Logf("failed to make message stale %s", result.Error)
+		t.FailNow()
+	}
+
+	job, hermesError := controllers.StartBackfill(db, &models.BackfillRequest{})
+	if hermesError != nil {
+		t.Logf("failed to start backfill %s", hermesError)
+		t.FailNow()
+	} else if job.Total != 1 {
+		t.Logf("wrong number of stale messages %d", job.Total)
+		t.FailNow()
+	}
+
+	if _, hermesError = controllers.RunBackfill(db, config, job.ID); hermesError != nil {
+		t.Logf("failed to run backfill %s", hermesError)
+		t.FailNow()
+	}
+
+	message := models.Message{}
+	if result = db.First(&message, 1); result.Error != nil {
+		t.Logf("failed to get message %s", result.Error)
+		t.FailNow()
+	} else if !message.Palindrome || message.AnalysisVersion != models.AnalysisVersion {
+		t.Logf("message was not re-analysed %v", message)
+		t.FailNow()
+	}
+
+	job, hermesError = controllers.GetBackfill(db)
+	if hermesError != nil {
+		t.Logf("failed to get backfill %s", hermesError)
+		t.FailNow()
+	} else if job.FinishedAt == nil || job.Processed != 1 {
+		t.Logf("backfill did not finish %v", job)
+		t.FailNow()
+	}
+}
+
+func TestMessageSocket(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
+	publishEvents(t, config)
+
+	// browsers can not set headers on websockets so the connection is opened with a ticket
+	var ticket models.EventTicket
+	jsonRequest(t, app, token, "POST", "/message/ticket", nil, &ticket)
+
+	// websockets need a real connection rather than app.Test
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Logf("failed to listen %s", err)
+		t.FailNow()
+	}
+	go func() {
+		_ = app.Listener(listener)
+	}()
+	defer func() {
+		_ = app.Shutdown()
+	}()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+listener.Addr().String()+"/message/ws?last_event_id=0&ticket="+ticket.Ticket, nil)
+	if err != nil {
+		t.Logf("failed to dial websocket %s", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	// the event from before connecting is replayed
+	var event models.Event
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err = conn.ReadJSON(&event); err != nil {
+		t.Logf("failed to read event %s", err)
+		t.FailNow()
+	} else if event.Type != models.EventMessageCreated || event.MessageID != 1 {
+		t.Logf("wrong event %v", event)
+		t.FailNow()
+	} else if event.Position != 1 {
+		t.Logf("wrong event position %d", event.Position)
+		t.FailNow()
+	}
+
+	// tickets are single use
+	_, resp, err = websocket.DefaultDialer.Dial("ws://"+listener.Addr().String()+"/message/ws?ticket="+ticket.Ticket, nil)
+	if err == nil || resp == nil || resp.StatusCode != fiber.StatusUnauthorized {
+		t.Logf("reused ticket was not rejected %v %s", resp, err)
+		t.FailNow()
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
+	publishEvents(t, config)
+
+	// the stream does not end so it needs a real connection rather than app.Test
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Logf("failed to listen %s", err)
+		t.FailNow()
+	}
+	go func() {
+		_ = app.Listener(listener)
+	}()
+	defer func() {
+		_ = app.Shutdown()
+	}()
+
+	req, err := http.NewRequest("GET", "http://"+listener.Addr().String()+"/message/stream", nil)
+	if err != nil {
+		t.Logf("failed to create request %s", err)
+		t.FailNow()
+	}
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "0")
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Logf("failed to get stream %s", err)
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+
+	// the event from before connecting is replayed
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Logf("failed to read event %s", err)
+			t.FailNow()
+		} else if line == "\n" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 || lines[0] != "id: 1\n" || lines[1] != "event: "+models.EventMessageCreated+"\n" {
+		t.Logf("wrong event %v", lines)
+		t.FailNow()
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	// the receiver is a plain http server on loopback, which is refused by default
+	resp = authRequest(t, app, token, "POST", "/webhook", map[string]interface{}{"url": "http://127.0.0.1/hook"})
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Logf("http loopback webhook was not refused: %s", resp.Status)
+		t.FailNow()
+	}
+	allowHTTP, allowPrivate := config.WebhookConfig.AllowHTTP, config.WebhookConfig.AllowPrivate
+	config.WebhookConfig.AllowHTTP, config.WebhookConfig.AllowPrivate = true, true
+	defer func() {
+		config.WebhookConfig.AllowHTTP, config.WebhookConfig.AllowPrivate = allowHTTP, allowPrivate
+	}()
+
+	payloads := make(chan models.WebhookPayload, 1)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !webhooks.Verify(secret, r.Header.Get(webhooks.TimestampHeader), body, r.Header.Get(webhooks.SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload models.WebhookPayload
+		_ = json.Unmarshal(body, &payload)
+		payloads <- payload
+	}))
+	defer receiver.Close()
+
+	reqBodyBytes, err := json.Marshal(map[string]interface{}{"url": receiver.URL, "events": []string{models.EventMessageCreated}})
+	if err != nil {
+		t.Log(fmt.Errorf("failed to marshal body %w", err))
+		t.FailNow()
+	}
+
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(reqBodyBytes))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var webhook models.Webhook
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &webhook); err != nil || webhook.Secret == "" {
+			t.Logf("failed unmarshal webhook %s %s", string(b), err)
+			t.FailNow()
+		}
+		secret = webhook.Secret
+	}
+
+	// only admins can receive every user's events
+	resp = authRequest(t, app, token, "POST", "/webhook", map[string]interface{}{"url": receiver.URL, "AllUsers": true})
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Logf("non admin was not refused an all users webhook: %s", resp.Status)
+		t.FailNow()
+	}
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test"})
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+	relayed, hermesError := controllers.RelayEvents(db, &config.OutboxConfig)
+	if hermesError != nil {
+		t.Logf("failed to relay events %s", hermesError)
+		t.FailNow()
+	} else if relayed != 1 {
+		t.Logf("wrong number of events relayed %d", relayed)
+		t.FailNow()
+	}
+
+	// relaying an event again must not deliver it twice
+	if result := db.Model(&models.Event{}).Where("true").Update("published_at", nil); result.Error != nil {
+		t.Logf("failed to reset events %s", result.Error)
+		t.FailNow()
+	}
+	if _, hermesError = controllers.RelayEvents(db, &config.OutboxConfig); hermesError != nil {
+		t.Logf("failed to relay events %s", hermesError)
+		t.FailNow()
+	}
+
+	delivered, hermesError := controllers.DeliverWebhooks(db, &config.WebhookConfig, receiver.Client())
+	if hermesError != nil {
+		t.Logf("failed to deliver webhooks %s", hermesError)
+		t.FailNow()
+	} else if delivered != 1 {
+		t.Logf("wrong number of deliveries %d", delivered)
+		t.FailNow()
+	}
+
+	payload := <-payloads
+	if payload.Type != models.EventMessageCreated || payload.MessageID != 1 {
+		t.Logf("wrong payload %v", payload)
+		t.FailNow()
+	}
+
+	req = httptest.NewRequest("GET", "/webhook/1/delivery", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	} else {
+		var deliveries struct {
+			Deliveries []models.WebhookDelivery
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, &deliveries); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		} else if len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].Status != models.DeliveryDelivered {
+			t.Logf("delivery was not logged %s", string(b))
+			t.FailNow()
+		}
+	}
+}
+
+// authRequest send a request with a json body as the token user
+func authRequest(t *testing.T, app *fiber.App, token string, method string, target string, body interface{}) *http.Response {
+	var reqBody io.Reader
+	if body != nil {
+		reqBodyBytes, err := json.Marshal(body)
+		if err != nil {
+			t.Logf("failed to marshal body %s", err)
+			t.FailNow()
+		}
+		reqBody = bytes.NewReader(reqBodyBytes)
+	}
+	req := httptest.NewRequest(method, target, reqBody)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err := app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	}
+	return resp
+}
+
+// publishEvents relay the stored events so they have positions for clients to resume from
+func publishEvents(t *testing.T, config *models.Config) {
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+	if _, hermesError = controllers.RelayEvents(db, &config.OutboxConfig); hermesError != nil {
+		t.Logf("failed to relay events %s", hermesError)
+		t.FailNow()
+	}
+}
+
+// jsonRequest send a request as the token user that must succeed and decode the response into out if it is not nil
+func jsonRequest(t *testing.T, app *fiber.App, token string, method string, target string, body interface{}, out interface{}) {
+	resp := authRequest(t, app, token, method, target, body)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status for %s %s: %s", method, target, resp.Status)
+		t.FailNow()
+	} else if out != nil {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Logf("failed to read body %s", err)
+			t.FailNow()
+		} else if err = json.Unmarshal(b, out); err != nil {
+			t.Logf("failed unmarshal body %s %s", string(b), err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "member", Password: "password"})
+	memberToken := getJwtFromResp(t, resp)
+
+	var group models.Group
+	jsonRequest(t, app, token, "POST", "/group", map[string]interface{}{"name": "team", "members": []map[string]interface{}{{"UserID": 2}}}, &group)
+	if group.ID != 1 || len(group.Members) != 2 {
+		t.Logf("wrong group %v", group)
+		t.FailNow()
+	}
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test", "GroupIDs": []uint{group.ID}})
+
+	// the member can read the message sent to the group
+	var message models.Message
+	jsonRequest(t, app, memberToken, "GET", "/message/1", nil, &message)
+	if message.Text != "test" || len(message.GroupIDs) != 1 || message.GroupIDs[0] != group.ID {
+		t.Logf("wrong message %v", message)
+		t.FailNow()
+	}
+
+	jsonRequest(t, app, token, "DELETE", "/group/1/member/2", nil, nil)
+
+	var audit struct {
+		Audit []models.GroupAudit
+	}
+	jsonRequest(t, app, token, "GET", "/group/1/audit", nil, &audit)
+	if len(audit.Audit) != 4 || audit.Audit[0].Action != models.MemberRemoved || audit.Audit[0].UserID != 2 {
+		t.Logf("wrong audit %v", audit.Audit)
+		t.FailNow()
+	}
+}
+
+func TestGroupLive(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	live := config.GroupConfig.Live
+	config.GroupConfig.Live = true
+	defer func() {
+		config.GroupConfig.Live = live
+	}()
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "member", Password: "password"})
+	memberToken := getJwtFromResp(t, resp)
+
+	jsonRequest(t, app, token, "POST", "/group", map[string]interface{}{"name": "team", "members": []map[string]interface{}{{"UserID": 2}}}, nil)
+
+	// members of a live group have no recipient row for a view once message to remove
+	resp = authRequest(t, app, token, "POST", "/message", map[string]interface{}{"text": "secret", "ViewOnce": true, "GroupIDs": []uint{1}})
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Logf("view once message to a live group was not refused: %s", resp.Status)
+		t.FailNow()
+	}
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test", "GroupIDs": []uint{1}})
+
+	// the member reads the message through their membership
+	var message models.Message
+	jsonRequest(t, app, memberToken, "GET", "/message/1", nil, &message)
+	if message.Text != "test" {
+		t.Logf("wrong message %v", message)
+		t.FailNow()
+	}
+
+	resp = authRequest(t, app, token, "POST", "/message/1", map[string]interface{}{"ViewOnce": true})
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Logf("message to a live group was made view once: %s", resp.Status)
+		t.FailNow()
+	}
+}
+
+func TestBlock(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	blockConfig := config.BlockConfig
+	defer func() {
+		config.BlockConfig = blockConfig
+	}()
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "blocker", Password: "password"})
+	blockerToken := getJwtFromResp(t, resp)
+	_ = addUserLogin(t, app, models.UserLogin{Username: "other", Password: "password"})
+	_ = addUserLogin(t, app, models.UserLogin{Username: "late", Password: "password"})
+
+	jsonRequest(t, app, blockerToken, "POST", "/block/1", nil, nil)
+
+	// rejected whether the blocker is a recipient when the message is sent or added by editing it
+	config.BlockConfig.DropBlocked = false
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "test", "Recipients": []map[string]interface{}{{"ID": 2}}}); resp.StatusCode != fiber.StatusForbidden {
+		t.Logf("message to a user that blocked the sender was not rejected: %s", resp.Status)
+		t.FailNow()
+	}
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test", "Recipients": []map[string]interface{}{{"ID": 3}}})
+	resp = authRequest(t, app, token, "POST", "/message/1", map[string]interface{}{"Recipients": []map[string]interface{}{{"ID": 3}, {"ID": 2}}})
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Logf("edit adding a user that blocked the sender was not rejected: %s", resp.Status)
+		t.FailNow()
+	}
+
+	// dropped from the recipients either way, the other recipients still get the message
+	config.BlockConfig.DropBlocked = true
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test", "Recipients": []map[string]interface{}{{"ID": 2}, {"ID": 3}}})
+	jsonRequest(t, app, token, "POST", "/message/1", map[string]interface{}{"Recipients": []map[string]interface{}{{"ID": 2}, {"ID": 4}}}, nil)
+
+	var messages map[string][]models.Message
+	jsonRequest(t, app, blockerToken, "GET", "/message", nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("blocked user was sent a message %v", messages["messages"])
+		t.FailNow()
+	}
+
+	// the recipient added by the edit is told about the message
+	var added []models.Event
+	result := db.Where("type = ?", models.EventRecipientAdded).Where("message_id = 1").Order("user_id").Find(&added)
+	if result.Error != nil {
+		t.Logf("failed to get events %s", result.Error)
+		t.FailNow()
+	} else if len(added) != 2 || added[0].UserID != 3 || added[1].UserID != 4 {
+		t.Logf("wrong recipient added events %v", added)
+		t.FailNow()
+	}
+
+	jsonRequest(t, app, blockerToken, "DELETE", "/block/1", nil, nil)
+	jsonRequest(t, app, blockerToken, "POST", "/mute/1", nil, nil)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test", "Recipients": []map[string]interface{}{{"ID": 2}}})
+
+	config.BlockConfig.HideMuted = true
+	jsonRequest(t, app, blockerToken, "GET", "/message", nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("message from a muted user was not hidden %v", messages["messages"])
+		t.FailNow()
+	}
+	jsonRequest(t, app, blockerToken, "GET", "/message/search?q=test", nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("message from a muted user was not hidden from search %v", messages["messages"])
+		t.FailNow()
+	}
+
+	config.BlockConfig.HideMuted = false
+	jsonRequest(t, app, blockerToken, "GET", "/message", nil, &messages)
+	if len(messages["messages"]) != 1 || !messages["messages"][0].Muted {
+		t.Logf("message from a muted user was not flagged %v", messages["messages"])
+		t.FailNow()
+	}
+	jsonRequest(t, app, blockerToken, "GET", "/message/search?q=test", nil, &messages)
+	if len(messages["messages"]) != 1 {
+		t.Logf("message from a muted user was not searched %v", messages["messages"])
+		t.FailNow()
+	}
+}
+
+func TestLabel(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test1"})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test2"})
+
+	var label, inbox, archive models.Label
+	jsonRequest(t, app, token, "POST", "/label", map[string]interface{}{"Name": "work"}, &label)
+	jsonRequest(t, app, token, "POST", "/label", map[string]interface{}{"Name": "inbox", "Folder": true}, &inbox)
+	jsonRequest(t, app, token, "POST", "/label", map[string]interface{}{"Name": "archive", "Folder": true}, &archive)
+
+	jsonRequest(t, app, token, "POST", fmt.Sprintf("/label/%d/apply", label.ID), map[string]interface{}{"MessageIDs": []uint{1, 2}}, nil)
+	jsonRequest(t, app, token, "POST", fmt.Sprintf("/label/%d/remove", label.ID), map[string]interface{}{"MessageIDs": []uint{2}}, nil)
+	// moving the message into the archive takes it out of the inbox
+	jsonRequest(t, app, token, "POST", fmt.Sprintf("/label/%d/apply", inbox.ID), map[string]interface{}{"MessageIDs": []uint{1}}, nil)
+	jsonRequest(t, app, token, "POST", fmt.Sprintf("/label/%d/apply", archive.ID), map[string]interface{}{"MessageIDs": []uint{1}}, nil)
+	jsonRequest(t, app, token, "POST", "/message/2/star", nil, nil)
+
+	var messages map[string][]models.Message
+	jsonRequest(t, app, token, "GET", fmt.Sprintf("/message?label=%d", label.ID), nil, &messages)
+	if len(messages["messages"]) != 1 || messages["messages"][0].ID != 1 || !reflect.DeepEqual(messages["messages"][0].Labels, []uint{label.ID, archive.ID}) {
+		t.Logf("wrong labelled messages %v", messages["messages"])
+		t.FailNow()
+	}
+
+	jsonRequest(t, app, token, "GET", fmt.Sprintf("/message?label=%d", inbox.ID), nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("message is still in the inbox %v", messages["messages"])
+		t.FailNow()
+	}
+
+	jsonRequest(t, app, token, "GET", "/message?starred=true", nil, &messages)
+	if len(messages["messages"]) != 1 || messages["messages"][0].ID != 2 || !messages["messages"][0].Starred {
+		t.Logf("wrong starred messages %v", messages["messages"])
+		t.FailNow()
+	}
+}
+
+func TestBatchMessages(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "recipient", Password: "password"})
+	recipientToken := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test1", "Recipients": []map[string]interface{}{{"ID": 2}}})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "test2", "Recipients": []map[string]interface{}{{"ID": 2}}})
+
+	var label models.Label
+	jsonRequest(t, app, recipientToken, "POST", "/label", map[string]interface{}{"Name": "work"}, &label)
+
+	// the recipient can not delete the owner's message but the rest of the batch is still applied
+	var batch struct {
+		Results []models.BatchResult
+	}
+	jsonRequest(t, app, recipientToken, "POST", "/message/batch", map[string]interface{}{"Operations": []map[string]interface{}{
+		{"Op": models.BatchRead, "MessageID": 1},
+		{"Op": models.BatchArchive, "MessageID": 1},
+		{"Op": models.BatchLabel, "MessageID": 2, "LabelID": label.ID},
+		{"Op": models.BatchDelete, "MessageID": 2},
+	}}, &batch)
+	statuses := make([]int, len(batch.Results))
+	for i, result := range batch.Results {
+		statuses[i] = result.Status
+	}
+	if !reflect.DeepEqual(statuses, []int{fiber.StatusOK, fiber.StatusOK, fiber.StatusOK, fiber.StatusNotFound}) {
+		t.Logf("wrong batch results %v", batch.Results)
+		t.FailNow()
+	}
+
+	var labels map[string][]models.Label
+	jsonRequest(t, app, recipientToken, "GET", "/label", nil, &labels)
+	if len(labels["labels"]) != 2 || labels["labels"][0].Name != models.ArchiveFolder || !labels["labels"][0].Folder {
+		t.Logf("archive folder was not created %v", labels["labels"])
+		t.FailNow()
+	}
+
+	var messages map[string][]models.Message
+	jsonRequest(t, app, recipientToken, "GET", fmt.Sprintf("/message?label=%d", labels["labels"][0].ID), nil, &messages)
+	if len(messages["messages"]) != 1 || messages["messages"][0].ID != 1 {
+		t.Logf("wrong archived messages %v", messages["messages"])
+		t.FailNow()
+	}
+
+	// a label the owner made with the archive folder's name is not used as the archive
+	jsonRequest(t, app, token, "POST", "/label", map[string]interface{}{"Name": models.ArchiveFolder}, nil)
+	jsonRequest(t, app, token, "POST", "/message/batch", map[string]interface{}{"Operations": []map[string]interface{}{
+		{"Op": models.BatchArchive, "MessageID": 1},
+	}}, &batch)
+	if len(batch.Results) != 1 || batch.Results[0].Status != fiber.StatusBadRequest {
+		t.Logf("archived into a label that is not a folder %v", batch.Results)
+		t.FailNow()
+	}
+
+	jsonRequest(t, app, token, "POST", "/message/batch", map[string]interface{}{"Operations": []map[string]interface{}{
+		{"Op": models.BatchDelete, "MessageID": 2},
+	}}, &batch)
+	if len(batch.Results) != 1 || batch.Results[0].Status != fiber.StatusOK {
+		t.Logf("owner could not delete message %v", batch.Results)
+		t.FailNow()
+	}
+}
+
+func TestForwardMessage(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "forwarder", Password: "password"})
+	forwarderToken := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "recipient", Password: "password"})
+	recipientToken := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "racecar", "Recipients": []map[string]interface{}{{"ID": 2}}})
+
+	// the recipient of the forward can not see the original so can not forward it
+	req := httptest.NewRequest("POST", "/message/1/forward", strings.NewReader(`{"Recipients": [{"ID": 1}]}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+recipientToken)
+	resp, err = app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	} else if resp.StatusCode == fiber.StatusOK {
+		t.Logf("user forwarded a message they can not see")
+		t.FailNow()
+	}
+
+	var forward map[string]uint
+	jsonRequest(t, app, forwarderToken, "POST", "/message/1/forward", map[string]interface{}{"Recipients": []map[string]interface{}{{"ID": 3}}}, &forward)
+
+	// the provenance is kept when the original is edited
+	jsonRequest(t, app, token, "POST", "/message/1", map[string]interface{}{"text": "edited"}, nil)
+
+	var message models.Message
+	jsonRequest(t, app, recipientToken, "GET", fmt.Sprintf("/message/%d", forward["id"]), nil, &message)
+	if message.OwnerID != 2 || message.Text != "racecar" || !message.Palindrome || message.ForwardedFrom == nil ||
+		message.ForwardedFrom.MessageID != 1 || message.ForwardedFrom.OwnerID != 1 {
+		t.Logf("wrong forwarded message %v", message)
+		t.FailNow()
+	}
+
+	// the forward keeps the original's text
+	resp = authRequest(t, app, forwarderToken, "POST", fmt.Sprintf("/message/%d", forward["id"]), map[string]interface{}{"text": "edited"})
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Logf("text of a forward was edited: %s", resp.Status)
+		t.FailNow()
+	}
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+
+	// the forward can be found as an anagram of its text
+	var anagramKey string
+	if err = db.Model(&models.Message{}).Where("id = ?", forward["id"]).Pluck("anagram_key", &anagramKey).Error; err != nil {
+		t.Logf("failed to get anagram key %s", err)
+		t.FailNow()
+	} else if anagramKey != models.AnagramKey(&config.AnalysisConfig, "racecar") {
+		t.Logf("wrong anagram key of forward %s", anagramKey)
+		t.FailNow()
+	}
+
+	// forwarding a palindrome does not count towards the forwarder's stats
+	if hermesError = controllers.RefreshStats(db); hermesError != nil {
+		t.Logf("failed to refresh stats %s", hermesError)
+		t.FailNow()
+	}
+	var stats models.UserStats
+	jsonRequest(t, app, forwarderToken, "GET", "/stats/me", nil, &stats)
+	if stats.Messages != 0 || stats.Palindromes != 0 {
+		t.Logf("forward counted in stats %v", stats)
+		t.FailNow()
+	}
+}
+
+func TestMentions(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	mentionConfig, blockConfig := config.MentionConfig, config.BlockConfig
+	defer func() {
+		config.MentionConfig, config.BlockConfig = mentionConfig, blockConfig
+	}()
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "mentioned", Password: "password"})
+	mentionedToken := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "blocker", Password: "password"})
+	blockerToken := getJwtFromResp(t, resp)
+
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "hi @mentioned and @nobody", "Recipients": []map[string]interface{}{{"ID": 2}}}); resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	}
+
+	// mentioning a user that is not a recipient rejects the message or adds them
+	config.MentionConfig.AddRecipients = false
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "@mentioned"}); resp.StatusCode == fiber.StatusOK {
+		t.Logf("message mentioning a user that is not a recipient was not rejected")
+		t.FailNow()
+	}
+	config.MentionConfig.AddRecipients = true
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "@mentioned"}); resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	}
+
+	var messages map[string][]models.Message
+	jsonRequest(t, app, mentionedToken, "GET", "/message/mentions", nil, &messages)
+	mentioning := map[uint]bool{}
+	for _, message := range messages["messages"] {
+		mentioning[message.ID] = true
+	}
+	if len(messages["messages"]) != 2 || !mentioning[1] || !mentioning[2] {
+		t.Logf("wrong mentioning messages %v", messages["messages"])
+		t.FailNow()
+	}
+
+	var message models.Message
+	jsonRequest(t, app, mentionedToken, "GET", "/message/1", nil, &message)
+	if !reflect.DeepEqual(message.Mentions, models.MentionEntities{{UserID: 2, Username: "mentioned", Start: 3, End: 13}}) {
+		t.Logf("wrong mentions %v", message.Mentions)
+		t.FailNow()
+	}
+
+	// a mentioned user dropped for blocking the sender is not pointed out in the message
+	jsonRequest(t, app, blockerToken, "POST", "/block/1", nil, nil)
+	config.BlockConfig.DropBlocked = true
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "@mentioned @blocker"}); resp.StatusCode != fiber.StatusOK {
+		t.Logf("bad status: %s", resp.Status)
+		t.FailNow()
+	}
+	jsonRequest(t, app, token, "GET", "/message/3", nil, &message)
+	if !reflect.DeepEqual(message.Mentions, models.MentionEntities{{UserID: 2, Username: "mentioned", Start: 0, End: 10}}) {
+		t.Logf("blocked user left in the mentions %v", message.Mentions)
+		t.FailNow()
+	}
+	jsonRequest(t, app, blockerToken, "GET", "/message/mentions", nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("blocked user was sent a mentioning message %v", messages["messages"])
+		t.FailNow()
+	}
+
+	// recipients added by a mention are part of the conversation anagrams are found in
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "@mentioned listen"})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "@mentioned silent"})
+	jsonRequest(t, app, token, "GET", "/message/5", nil, &message)
+	if anagram := message.Analysis["anagram"]; !anagram.Result || !reflect.DeepEqual(anagram.Details["message_ids"], []interface{}{float64(4)}) {
+		t.Logf("anagram in the conversation with a mentioned user not found %v", anagram)
+		t.FailNow()
+	}
+
+	// a group member who blocked the owner does not get the message so mentioning them is not reaching them
+	var group models.Group
+	jsonRequest(t, app, token, "POST", "/group", map[string]interface{}{"name": "team", "members": []map[string]interface{}{{"UserID": 3}}}, &group)
+	config.MentionConfig.AddRecipients = false
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "@blocker", "GroupIDs": []uint{group.ID}}); resp.StatusCode == fiber.StatusOK {
+		t.Logf("message mentioning a group member that blocked the owner was not rejected")
+		t.FailNow()
+	}
+	config.MentionConfig.AddRecipients = true
+	config.BlockConfig.DropBlocked = false
+	if resp = addMessage(t, app, token, map[string]interface{}{"text": "@blocker", "GroupIDs": []uint{group.ID}}); resp.StatusCode == fiber.StatusOK {
+		t.Logf("message adding a group member that blocked the owner was not rejected")
+		t.FailNow()
+	}
+	config.BlockConfig.DropBlocked = true
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "@blocker", "GroupIDs": []uint{group.ID}})
+	jsonRequest(t, app, token, "GET", "/message/6", nil, &message)
+	if len(message.Mentions) != 0 {
+		t.Logf("blocked group member left in the mentions %v", message.Mentions)
+		t.FailNow()
+	}
+	jsonRequest(t, app, blockerToken, "GET", "/message/mentions", nil, &messages)
+	if len(messages["messages"]) != 0 {
+		t.Logf("blocked group member was sent a mentioning message %v", messages["messages"])
+		t.FailNow()
+	}
+}
+
+func TestViewOnce(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "recipient", Password: "password"})
+	recipientToken := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "secret", "ViewOnce": true, "Recipients": []map[string]interface{}{{"ID": 2}}})
+
+	// listing the message does not show or use up its content
+	var messages map[string][]models.Message
+	jsonRequest(t, app, recipientToken, "GET", "/message", nil, &messages)
+	if len(messages["messages"]) != 1 || messages["messages"][0].Text != "" {
+		t.Logf("view once message was listed with its content %v", messages["messages"])
+		t.FailNow()
+	}
+
+	var message models.Message
+	jsonRequest(t, app, recipientToken, "GET", "/message/1", nil, &message)
+	if message.Text != "secret" {
+		t.Logf("wrong message %v", message)
+		t.FailNow()
+	}
+
+	if resp = authRequest(t, app, recipientToken, "GET", "/message/1", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Logf("view once message was read twice: %s", resp.Status)
+		t.FailNow()
+	}
+
+	// the owner still has the message
+	jsonRequest(t, app, token, "GET", "/message/1", nil, &message)
+	if message.Text != "secret" {
+		t.Logf("wrong message for the owner %v", message)
+		t.FailNow()
+	}
+}
+
+func TestReapMessages(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "recipient", Password: "password"})
+	recipientToken := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "expiring", "TTL": 3600, "Recipients": []map[string]interface{}{{"ID": 2}}})
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "kept", "Recipients": []map[string]interface{}{{"ID": 2}}})
+
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+	db.Model(&models.Message{}).Where("id = ?", 1).Update("expires_at", time.Now().Add(-time.Minute))
+
+	// expired messages are hidden before they are reaped
+	if resp = authRequest(t, app, recipientToken, "GET", "/message/1", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Logf("expired message was returned: %s", resp.Status)
+		t.FailNow()
+	}
+
+	reaped, hermesError := controllers.ReapMessages(db)
+	if hermesError != nil {
+		t.Logf("failed to reap messages %s", hermesError)
+		t.FailNow()
+	} else if reaped != 1 {
+		t.Logf("wrong number of reaped messages %d", reaped)
+		t.FailNow()
+	}
+
+	var messages, recipients int64
+	db.Unscoped().Model(&models.Message{}).Count(&messages)
+	db.Unscoped().Model(&models.Recipient{}).Count(&recipients)
+	if messages != 1 || recipients != 1 {
+		t.Logf("expired message was not removed, %d messages %d recipients", messages, recipients)
+		t.FailNow()
+	}
+}
+
+func addAttachment(t *testing.T, app *fiber.App, token string, messageId uint, filename string, data []byte) *http.Response {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Logf("failed to create form file %s", err)
+		t.FailNow()
+	}
+	if _, err = part.Write(data); err != nil {
+		t.Logf("failed to write form file %s", err)
+		t.FailNow()
+	}
+	if err = writer.Close(); err != nil {
+		t.Logf("failed to close form %s", err)
+		t.FailNow()
+	}
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/message/%d/attachment", messageId), &body)
+	req.Header.Set(fiber.HeaderContentType, writer.FormDataContentType())
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	resp, err := app.Test(req, int(time.Hour.Milliseconds()))
+	if err != nil {
+		t.Logf("failed to test app %s", err)
+		t.FailNow()
+	}
+	return resp
+}
+
+func TestAttachment(t *testing.T) {
+	app := getApp()
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	store, err := storage.GetBlobStore(&config.AttachmentConfig.BlobStore)
+	if err != nil {
+		t.Logf("failed to get blob store %s", err)
+		t.FailNow()
+	}
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		t.Logf("failed to connect to db %s", hermesError)
+		t.FailNow()
+	}
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+	resp = addUserLogin(t, app, models.UserLogin{Username: "recipient", Password: "password"})
+	recipientToken := getJwtFromResp(t, resp)
+
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "attached", "Recipients": []map[string]interface{}{{"ID": 2}}})
+
+	data := []byte("attachment for the test")
+	resp = addAttachment(t, app, token, 1, "test.txt", data)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Logf("failed to add attachment %s", resp.Status)
+		t.FailNow()
+	}
+	var attachment models.Attachment
+	if err = json.NewDecoder(resp.Body).Decode(&attachment); err != nil {
+		t.Logf("failed to decode attachment %s", err)
+		t.FailNow()
+	}
+	if attachment.ContentType != "text/plain" || attachment.Filename != "test.txt" || attachment.Size != int64(len(data)) {
+		t.Logf("wrong attachment %v", attachment)
+		t.FailNow()
+	}
+
+	// only the owner can attach files
+	if resp = addAttachment(t, app, recipientToken, 1, "test.txt", data); resp.StatusCode != fiber.StatusNotFound {
+		t.Logf("recipient attached a file %s", resp.Status)
+		t.FailNow()
+	}
+
+	resp = authRequest(t, app, recipientToken, "GET", fmt.Sprintf("/message/1/attachment/%d", attachment.ID), nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Logf("failed to get attachment %s", resp.Status)
+		t.FailNow()
+	}
+	actual, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Logf("failed to read attachment %s", err)
+		t.FailNow()
+	}
+	if !bytes.Equal(data, actual) {
+		t.Logf("wrong attachment content expected %s actual %s", data, actual)
+		t.FailNow()
+	}
+
+	// the forward shares the blob so it is kept when the original is deleted
+	var forward map[string]uint
+	jsonRequest(t, app, recipientToken, "POST", "/message/1/forward", map[string]interface{}{"Recipients": []map[string]interface{}{{"ID": 1}}}, &forward)
+	jsonRequest(t, app, token, "DELETE", "/message/1", nil, nil)
+	if _, hermesError = controllers.ReapBlobs(db, store); hermesError != nil {
+		t.Logf("failed to reap blobs %s", hermesError)
+		t.FailNow()
+	}
+	if resp = authRequest(t, app, recipientToken, "GET", fmt.Sprintf("/message/1/attachment/%d", attachment.ID), nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Logf("got attachment of a deleted message %s", resp.Status)
+		t.FailNow()
+	}
+	var message models.Message
+	jsonRequest(t, app, recipientToken, "GET", fmt.Sprintf("/message/%d", forward["id"]), nil, &message)
+	if len(message.Attachments) != 1 {
+		t.Logf("wrong forward attachments %v", message.Attachments)
+		t.FailNow()
+	}
+	resp = authRequest(t, app, token, "GET", fmt.Sprintf("/message/%d/attachment/%d", forward["id"], message.Attachments[0].ID), nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Logf("failed to get forwarded attachment %s", resp.Status)
+		t.FailNow()
+	}
+
+	// the blob is deleted once nothing references it
+	jsonRequest(t, app, recipientToken, "DELETE", fmt.Sprintf("/message/%d", forward["id"]), nil, nil)
+	reaped, hermesError := controllers.ReapBlobs(db, store)
+	if hermesError != nil {
+		t.Logf("failed to reap blobs %s", hermesError)
+		t.FailNow()
+	} else if reaped != 1 {
+		t.Logf("wrong number of reaped blobs %d", reaped)
+		t.FailNow()
+	}
+	if _, err = store.Get(attachment.Hash); !errors.Is(err, storage.ErrNotFound) {
+		t.Logf("blob was not deleted %s", err)
+		t.FailNow()
+	}
+
+	// the attachments of a view once message can only be downloaded by the owner
+	mustAddMessage(t, app, token, map[string]interface{}{"text": "secret", "ViewOnce": true, "Recipients": []map[string]interface{}{{"ID": 2}}})
+	resp = addAttachment(t, app, token, 3, "secret.txt", []byte("view once attachment"))
+	if resp.StatusCode != fiber.StatusOK {
+		t.Logf("failed to add attachment %s", resp.Status)
+		t.FailNow()
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&attachment); err != nil {
+		t.Logf("failed to decode attachment %s", err)
+		t.FailNow()
+	}
+	if resp = authRequest(t, app, recipientToken, "GET", fmt.Sprintf("/message/3/attachment/%d", attachment.ID), nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Logf("recipient downloaded a view once attachment %s", resp.Status)
+		t.FailNow()
+	}
+	if resp = authRequest(t, app, token, "GET", fmt.Sprintf("/message/3/attachment/%d", attachment.ID), nil); resp.StatusCode != fiber.StatusOK {
+		t.Logf("owner could not download a view once attachment %s", resp.Status)
+		t.FailNow()
+	}
+	// the message is still there to be viewed once
+	jsonRequest(t, app, recipientToken, "GET", "/message/3", nil, &message)
+	if message.Text != "secret" {
+		t.Logf("wrong view once message %v", message)
+		t.FailNow()
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	config, err := models.GetConfig()
+	if err != nil {
+		t.FailNow()
+	}
+
+	// the limiter is created with the app so the limit has to be set first
+	max := config.AnalyzeRateLimit.Max
+	config.AnalyzeRateLimit.Max = 2
+	defer func() {
+		config.AnalyzeRateLimit.Max = max
+	}()
+	app := getApp()
+
+	setup(t, &config.DBConfig)
+	defer teardown(t, &config.DBConfig)
+
+	resp := addUser(t, app)
+	token := getJwtFromResp(t, resp)
+
+	if resp = authRequest(t, app, "not a token", "POST", "/analyze", map[string]interface{}{"text": "racecar"}); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Logf("analyzed without a valid token %s", resp.Status)
+		t.FailNow()
+	}
+
+	var report models.AnalysisReport
+	jsonRequest(t, app, token, "POST", "/analyze", map[string]interface{}{"text": "racecar"}, &report)
+	if !report.Analysis["palindrome"].Result || report.Normalised != "racecar" ||
+		report.Centre != (models.PalindromeSpan{Start: 3, End: 4, Text: "e"}) ||
+		report.LongestPalindrome != (models.PalindromeSpan{Start: 0, End: 7, Text: "racecar"}) {
+		t.Logf("wrong analysis report %v", report)
+		t.FailNow()
+	}
+
+	if resp = authRequest(t, app, token, "POST", "/analyze", map[string]interface{}{}); resp.StatusCode != fiber.StatusBadRequest {
+		t.Logf("analyzed without text %s", resp.Status)
+		t.FailNow()
+	}
+
+	// the limit is per user so the failed request without a token is not counted
+	if resp = authRequest(t, app, token, "POST", "/analyze", map[string]interface{}{"text": "racecar"}); resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Logf("rate limit was not applied %s", resp.Status)
+		t.FailNow()
+	}
+}
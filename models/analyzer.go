@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+)
+
+// AnalysisVersion version of the word play analysis stored with each message, increment it whenever an analyzer is
+// added or its logic changes so the backfill can find messages with stale results
+const AnalysisVersion = 2
+
+// Analyzer a word play check run on the text of every message
+type Analyzer interface {
+	// Name unique key the result is stored under
+	Name() string
+	// Analyze check the text, the text is not normalised so analyzers can choose to call normalise
+	Analyze(config *AnalysisConfig, text string) AnalysisResult
+}
+
+type AnalysisResult struct {
+	Result  bool
+	Details map[string]interface{} `json:",omitempty"`
+}
+
+// Analysis results of each analyzer by analyzer name, stored as jsonb
+type Analysis map[string]AnalysisResult
+
+// Value marshal the analysis to json for the db
+func (a Analysis) Value() (driver.Value, error) {
+	return jsonValue(a, a == nil)
+}
+
+// Scan unmarshal the analysis from the json in the db
+func (a *Analysis) Scan(value interface{}) error {
+	return jsonScan(value, a)
+}
+
+var analyzersLock = &sync.RWMutex{}
+
+var analyzers = map[string]Analyzer{}
+
+// RegisterAnalyzer add an analyzer to the registry, registering the same name twice is a programming error
+func RegisterAnalyzer(analyzer Analyzer) {
+	analyzersLock.Lock()
+	defer analyzersLock.Unlock()
+	if _, ok := analyzers[analyzer.Name()]; ok {
+		panic(fmt.Sprintf("analyzer %s is already registered", analyzer.Name()))
+	}
+	analyzers[analyzer.Name()] = analyzer
+}
+
+// EnabledAnalyzers get the registered analyzers enabled by config sorted by name
+func EnabledAnalyzers(config *AnalysisConfig) []Analyzer {
+	analyzersLock.RLock()
+	defer analyzersLock.RUnlock()
+	var enabled []Analyzer
+	for name, analyzer := range analyzers {
+		if config.AnalyzerEnabled(name) {
+			enabled = append(enabled, analyzer)
+		}
+	}
+	sort.Slice(enabled, func(i, j int) bool {
+		return enabled[i].Name() < enabled[j].Name()
+	})
+	return enabled
+}
+
+// Analyze run all enabled analyzers on the text
+func Analyze(config *AnalysisConfig, text string) Analysis {
+	analysis := Analysis{}
+	for _, analyzer := range EnabledAnalyzers(config) {
+		analysis[analyzer.Name()] = analyzer.Analyze(config, text)
+	}
+	return analysis
+}
+
+// HasAnalysis scope a query to messages where all the named analyzers had a positive result
+func HasAnalysis(names []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, name := range names {
+			//json containment can use the gin index on the analysis column
+			filter, err := json.Marshal(Analysis{name: {Result: true}})
+			if err != nil {
+				_ = db.AddError(err)
+				return db
+			}
+			db = db.Where("messages.analysis @> ?", string(filter))
+		}
+		return db
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import "testing"
+
+type testAnalyzer struct{}
+
+func (testAnalyzer) Name() string {
+	return "test"
+}
+
+func (testAnalyzer) Analyze(_ *AnalysisConfig, text string) AnalysisResult {
+	return AnalysisResult{Result: text == "test", Details: map[string]interface{}{"length": len(text)}}
+}
+
+func TestRegisterAnalyzer(t *testing.T) {
+	RegisterAnalyzer(testAnalyzer{})
+	defer func() {
+		analyzersLock.Lock()
+		delete(analyzers, "test")
+		analyzersLock.Unlock()
+	}()
+
+	analysis := Analyze(&analysisConfig, "test")
+
+	if result, ok := analysis["test"]; !ok || !result.Result {
+		t.Errorf("registered analyzer was not run %v", analysis)
+	}
+}
+
+func TestAnalyze_Disabled(t *testing.T) {
+	config := analysisConfig
+	config.DisabledAnalyzers = []string{"palindrome"}
+
+	analysis := Analyze(&config, "test")
+
+	if _, ok := analysis["palindrome"]; ok {
+		t.Errorf("disabled analyzer was run %v", analysis)
+	} else if _, ok := analysis["palindrome_normalised"]; !ok {
+		t.Errorf("enabled analyzer was not run %v", analysis)
+	}
+}
+
+func TestAnalyze_Enabled(t *testing.T) {
+	config := analysisConfig
+	config.EnabledAnalyzers = []string{"palindrome"}
+
+	analysis := Analyze(&config, "test")
+
+	if len(analysis) != 1 {
+		t.Errorf("only the enabled analyzer should run %v", analysis)
+	} else if _, ok := analysis["palindrome"]; !ok {
+		t.Errorf("enabled analyzer was not run %v", analysis)
+	}
+}
+
+func TestAnalysis_ScanValue(t *testing.T) {
+	analysis := Analysis{"palindrome": {Result: true}}
+
+	value, err := analysis.Value()
+	if err != nil {
+		t.Logf("failed to get value %s", err)
+		t.FailNow()
+	}
+
+	var actual Analysis
+	err = actual.Scan(value)
+	if err != nil {
+		t.Logf("failed to scan value %s", err)
+		t.FailNow()
+	}
+	if !actual["palindrome"].Result || len(actual) != 1 {
+		t.Errorf("analysis is not the same %v", actual)
+	}
+}
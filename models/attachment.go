@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Attachment struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `json:"-"`
+	MessageID   uint      `gorm:"index"`
+	Filename    string
+	ContentType string
+	Size        int64
+	Hash        string `gorm:"index"`
+}
+
+// Blob reference count of the attachments sharing a stored blob, blobs nothing references are deleted by the reaper
+type Blob struct {
+	Hash      string `gorm:"primaryKey"`
+	UpdatedAt time.Time
+	Refs      int `gorm:"index"`
+}
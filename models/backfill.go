@@ -0,0 +1,36 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// BackfillJob progress of re-running the word play analysis over stored messages, messages are analysed in id order so
+// the job can resume after the cursor if it is interrupted
+type BackfillJob struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Version analysis version the messages are brought up to
+	Version uint
+	// All re-analyse messages that are already at the version, for when the analysis config changes
+	All bool
+	// Cursor id of the last message analysed
+	Cursor     uint
+	Processed  int64
+	Total      int64
+	FinishedAt *time.Time
+}
+
+type BackfillRequest struct {
+	All bool
+}
+
+// Stale scope a query to the messages the job still has to analyse, drafts are analysed when they are sent
+func (j *BackfillJob) Stale(db *gorm.DB) *gorm.DB {
+	db = db.Where("messages.id > ?", j.Cursor).Where("NOT messages.draft")
+	if !j.All {
+		db = db.Where("messages.analysis_version < ?", j.Version)
+	}
+	return db
+}
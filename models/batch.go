@@ -0,0 +1,35 @@
+package models
+
+const (
+	// BatchDelete delete a message the user owns
+	BatchDelete = "delete"
+	// BatchRead mark a message sent to the user read
+	BatchRead = "read"
+	// BatchArchive move a message the user can see to their archive folder
+	BatchArchive = "archive"
+	// BatchLabel apply one of the user's labels to a message they can see
+	BatchLabel = "label"
+)
+
+// ArchiveFolder name of the folder archived messages are moved to, it is created the first time a user archives
+const ArchiveFolder = "Archive"
+
+// BatchRequest operations to apply to messages in a single transaction
+type BatchRequest struct {
+	Operations []BatchOperation `validate:"required,min=1,max=100,dive"`
+}
+
+// BatchOperation operation on one message, LabelID is only used by label
+type BatchOperation struct {
+	Op        string `validate:"required,oneof=delete read archive label"`
+	MessageID uint   `validate:"required"`
+	LabelID   uint
+}
+
+// BatchResult outcome of one operation, Status is the http status the single message endpoint would have returned
+type BatchResult struct {
+	Op        string
+	MessageID uint
+	Status    int
+	Error     string `json:",omitempty"`
+}
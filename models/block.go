@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Block stops a user from being sent messages by the blocked user
+type Block struct {
+	UserID    uint `gorm:"primaryKey" json:"-"`
+	BlockedID uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+	User      *User `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Blocked   *User `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Mute hides or flags the messages a user gets from the muted user
+type Mute struct {
+	UserID    uint `gorm:"primaryKey" json:"-"`
+	MutedID   uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	User      *User `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Muted     *User `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
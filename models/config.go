@@ -8,15 +8,30 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var lock = &sync.Mutex{}
 
 type Config struct {
-	DBConfig       DBConfig
-	JWTConfig      JWTConfig
-	PasswordConfig PasswordConfig
+	DBConfig         DBConfig
+	JWTConfig        JWTConfig
+	PasswordConfig   PasswordConfig
+	MessageConfig    MessageConfig
+	AttachmentConfig AttachmentConfig
+	AnalysisConfig   AnalysisConfig
+	AnalyzeRateLimit RateLimitConfig
+	StatsConfig      StatsConfig
+	BackfillConfig   BackfillConfig
+	AdminConfig      AdminConfig
+	EventConfig      EventConfig
+	WebhookConfig    WebhookConfig
+	OutboxConfig     OutboxConfig
+	GroupConfig      GroupConfig
+	BlockConfig      BlockConfig
+	MentionConfig    MentionConfig
 }
 
 var config *Config
@@ -45,7 +60,99 @@ func GetConfig() (*Config, error) {
 				return &Config{}, err
 			}
 
-			config = &Config{DBConfig: dbConfig, JWTConfig: jwtConfig, PasswordConfig: passwordConfig}
+			messageConfig := MessageConfig{}
+			err = messageConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			attachmentConfig := AttachmentConfig{}
+			err = attachmentConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			analysisConfig := AnalysisConfig{}
+			err = analysisConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			analyzeRateLimit := RateLimitConfig{}
+			err = analyzeRateLimit.getConfigFromENV("ANALYZE", 30)
+			if err != nil {
+				return &Config{}, err
+			}
+
+			statsConfig := StatsConfig{}
+			err = statsConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			backfillConfig := BackfillConfig{}
+			err = backfillConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			adminConfig := AdminConfig{}
+			adminConfig.getConfigFromENV()
+
+			eventConfig := EventConfig{}
+			err = eventConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			webhookConfig := WebhookConfig{}
+			err = webhookConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			outboxConfig := OutboxConfig{}
+			err = outboxConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			groupConfig := GroupConfig{}
+			err = groupConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			blockConfig := BlockConfig{}
+			err = blockConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			mentionConfig := MentionConfig{}
+			err = mentionConfig.getConfigFromENV()
+			if err != nil {
+				return &Config{}, err
+			}
+
+			config = &Config{
+				DBConfig:         dbConfig,
+				JWTConfig:        jwtConfig,
+				PasswordConfig:   passwordConfig,
+				MessageConfig:    messageConfig,
+				AttachmentConfig: attachmentConfig,
+				AnalysisConfig:   analysisConfig,
+				AnalyzeRateLimit: analyzeRateLimit,
+				StatsConfig:      statsConfig,
+				BackfillConfig:   backfillConfig,
+				AdminConfig:      adminConfig,
+				EventConfig:      eventConfig,
+				WebhookConfig:    webhookConfig,
+				OutboxConfig:     outboxConfig,
+				GroupConfig:      groupConfig,
+				BlockConfig:      blockConfig,
+				MentionConfig:    mentionConfig,
+			}
 		}
 	}
 	return config, nil
@@ -112,7 +219,7 @@ func (c *DBConfig) getConfigFromENV() error {
 	return nil
 }
 
-//GetPsqlConn get postgresql formatted connection string from configuration
+// GetPsqlConn get postgresql formatted connection string from configuration
 func (c *DBConfig) GetPsqlConn() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", c.host, c.port, c.user, c.password, c.dbname)
 }
@@ -180,3 +287,520 @@ func (c *PasswordConfig) getConfigFromENV() error {
 	c.PepperKey = []byte(pepperKey)
 	return err
 }
+
+// getDurationFromENV load a duration from env or use the fallback if it is not set
+func getDurationFromENV(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
+
+type MessageConfig struct {
+	ReaperInterval time.Duration
+	// LongPollMaxWait longest a request may wait for new messages
+	LongPollMaxWait time.Duration
+	// LongPollMaxWaiters number of requests that may wait for new messages at once on each instance
+	LongPollMaxWaiters int
+}
+
+func (c *MessageConfig) getConfigFromENV() error {
+	reaperInterval, err := getDurationFromENV("REAPER_INTERVAL", time.Minute)
+	if err != nil {
+		return err
+	}
+	c.ReaperInterval = reaperInterval
+
+	longPollMaxWait, err := getDurationFromENV("LONG_POLL_MAX_WAIT", time.Minute)
+	if err != nil {
+		return err
+	}
+	c.LongPollMaxWait = longPollMaxWait
+
+	longPollMaxWaiters, err := getIntFromENV("LONG_POLL_MAX_WAITERS", 1000)
+	if err != nil {
+		return err
+	}
+	c.LongPollMaxWaiters = longPollMaxWaiters
+	return nil
+}
+
+// getStringFromENV load a string from env or use the fallback if it is not set
+func getStringFromENV(key string, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// getIntFromENV load an integer from env or use the fallback if it is not set
+func getIntFromENV(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+type AttachmentConfig struct {
+	MaxSize      int64
+	AllowedTypes []string
+	BlobStore    BlobStoreConfig
+}
+
+func (c *AttachmentConfig) getConfigFromENV() error {
+	maxSize, err := getIntFromENV("ATTACHMENT_MAX_SIZE", 10*1024*1024)
+	if err != nil {
+		return err
+	}
+	c.MaxSize = int64(maxSize)
+
+	c.AllowedTypes = splitList(getStringFromENV("ATTACHMENT_ALLOWED_TYPES", "image/png,image/jpeg,image/gif,application/pdf,text/plain"))
+
+	return c.BlobStore.getConfigFromENV()
+}
+
+// TypeAllowed check if attachments with the mime type can be uploaded
+func (c *AttachmentConfig) TypeAllowed(contentType string) bool {
+	for _, allowedType := range c.AllowedTypes {
+		if strings.TrimSpace(allowedType) == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+type BlobStoreConfig struct {
+	Backend     string
+	LocalPath   string
+	S3Endpoint  string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+}
+
+func (c *BlobStoreConfig) getConfigFromENV() error {
+	c.Backend = getStringFromENV("BLOB_STORE", "local")
+	c.LocalPath = getStringFromENV("BLOB_STORE_PATH", "attachments")
+	c.S3Endpoint = os.Getenv("S3_ENDPOINT")
+	c.S3Bucket = getStringFromENV("S3_BUCKET", "hermes")
+
+	accessKey, err := getVarFromFileOrENV("S3_ACCESS_KEY")
+	if err != nil {
+		return err
+	}
+	c.S3AccessKey = accessKey
+
+	secretKey, err := getVarFromFileOrENV("S3_SECRET_KEY")
+	if err != nil {
+		return err
+	}
+	c.S3SecretKey = secretKey
+
+	c.S3UseSSL = os.Getenv("S3_USE_SSL") == "true"
+	return nil
+}
+
+// getBoolFromENV load a boolean from env or use the fallback if it is not set
+func getBoolFromENV(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+type AnalysisConfig struct {
+	FoldCase          bool
+	StripAccents      bool
+	IgnorePunctuation bool
+	IgnoreWhitespace  bool
+	// EnabledAnalyzers only run these analyzers, all analyzers run if empty
+	EnabledAnalyzers  []string
+	DisabledAnalyzers []string
+	// Alphabet letters a pangram must use
+	Alphabet string
+	// LipogramLetter letter a lipogram must not use
+	LipogramLetter string
+	// Dictionary normalised words used to find semordnilaps
+	Dictionary map[string]bool
+}
+
+// splitList split a comma separated list ignoring empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AnalyzerEnabled check if the analyzer should be run
+func (c *AnalysisConfig) AnalyzerEnabled(name string) bool {
+	for _, disabled := range c.DisabledAnalyzers {
+		if disabled == name {
+			return false
+		}
+	}
+	if len(c.EnabledAnalyzers) == 0 {
+		return true
+	}
+	for _, enabled := range c.EnabledAnalyzers {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *AnalysisConfig) getConfigFromENV() error {
+	c.EnabledAnalyzers = splitList(os.Getenv("ANALYZERS_ENABLED"))
+	c.DisabledAnalyzers = splitList(os.Getenv("ANALYZERS_DISABLED"))
+	c.Alphabet = getStringFromENV("ANALYSIS_ALPHABET", "abcdefghijklmnopqrstuvwxyz")
+	c.LipogramLetter = getStringFromENV("ANALYSIS_LIPOGRAM_LETTER", "e")
+
+	var err error
+	c.FoldCase, err = getBoolFromENV("ANALYSIS_FOLD_CASE", true)
+	if err != nil {
+		return err
+	}
+	c.StripAccents, err = getBoolFromENV("ANALYSIS_STRIP_ACCENTS", true)
+	if err != nil {
+		return err
+	}
+	c.IgnorePunctuation, err = getBoolFromENV("ANALYSIS_IGNORE_PUNCTUATION", true)
+	if err != nil {
+		return err
+	}
+	c.IgnoreWhitespace, err = getBoolFromENV("ANALYSIS_IGNORE_WHITESPACE", true)
+	if err != nil {
+		return err
+	}
+
+	if fileName := os.Getenv("ANALYSIS_DICTIONARY_FILE"); fileName != "" {
+		wordList, err := readFile(fileName)
+		if err != nil {
+			return err
+		}
+		c.LoadDictionary(string(wordList))
+	}
+	return nil
+}
+
+// LoadDictionary load a word list with one word per line, words are normalised so they match analyzed text
+func (c *AnalysisConfig) LoadDictionary(wordList string) {
+	c.Dictionary = map[string]bool{}
+	for _, line := range strings.Split(wordList, "\n") {
+		for _, word := range words(c, line) {
+			c.Dictionary[word] = true
+		}
+	}
+}
+
+// InDictionary check if every space separated word is in the dictionary
+func (c *AnalysisConfig) InDictionary(text string) bool {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		if !c.Dictionary[word] {
+			return false
+		}
+	}
+	return true
+}
+
+type RateLimitConfig struct {
+	// Max number of requests for each user in a window
+	Max    int
+	Window time.Duration
+}
+
+// getConfigFromENV load the limit for the prefix from env, the window defaults to a minute
+func (c *RateLimitConfig) getConfigFromENV(prefix string, fallback int) error {
+	max, err := getIntFromENV(prefix+"_RATE_LIMIT", fallback)
+	if err != nil {
+		return err
+	}
+	c.Max = max
+
+	window, err := getDurationFromENV(prefix+"_RATE_WINDOW", time.Minute)
+	if err != nil {
+		return err
+	}
+	c.Window = window
+	return nil
+}
+
+type StatsConfig struct {
+	// RefreshInterval how often the user stats view is recomputed
+	RefreshInterval time.Duration
+	// LeaderboardSize default number of users on the leaderboard
+	LeaderboardSize int
+}
+
+func (c *StatsConfig) getConfigFromENV() error {
+	refreshInterval, err := getDurationFromENV("STATS_REFRESH_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	c.RefreshInterval = refreshInterval
+
+	leaderboardSize, err := getIntFromENV("LEADERBOARD_SIZE", 10)
+	if err != nil {
+		return err
+	}
+	c.LeaderboardSize = leaderboardSize
+	return nil
+}
+
+type BackfillConfig struct {
+	// BatchSize number of messages analysed in each transaction
+	BatchSize int
+	// BatchDelay pause between batches to limit the load on the db
+	BatchDelay time.Duration
+}
+
+func (c *BackfillConfig) getConfigFromENV() error {
+	batchSize, err := getIntFromENV("BACKFILL_BATCH_SIZE", 100)
+	if err != nil {
+		return err
+	}
+	c.BatchSize = batchSize
+
+	batchDelay, err := getDurationFromENV("BACKFILL_BATCH_DELAY", time.Second)
+	if err != nil {
+		return err
+	}
+	c.BatchDelay = batchDelay
+	return nil
+}
+
+type AdminConfig struct {
+	// Usernames users allowed to use the admin endpoints
+	Usernames []string
+}
+
+func (c *AdminConfig) getConfigFromENV() {
+	c.Usernames = splitList(getStringFromENV("ADMIN_USERNAMES", ""))
+}
+
+// IsAdmin check if the username is an admin
+func (c *AdminConfig) IsAdmin(username string) bool {
+	for _, admin := range c.Usernames {
+		if admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+type EventConfig struct {
+	// HeartbeatInterval how often connected clients are pinged
+	HeartbeatInterval time.Duration
+	// Retention how long events are kept for clients to resume from
+	Retention time.Duration
+	// TicketTTL how long an event ticket can be used for
+	TicketTTL time.Duration
+}
+
+func (c *EventConfig) getConfigFromENV() error {
+	heartbeatInterval, err := getDurationFromENV("EVENT_HEARTBEAT_INTERVAL", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	c.HeartbeatInterval = heartbeatInterval
+
+	retention, err := getDurationFromENV("EVENT_RETENTION", 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	c.Retention = retention
+
+	ticketTTL, err := getDurationFromENV("EVENT_TICKET_TTL", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	c.TicketTTL = ticketTTL
+	return nil
+}
+
+type WebhookConfig struct {
+	// MaxAttempts failed attempts before a delivery is dead lettered
+	MaxAttempts int
+	// Backoff wait after the first failed attempt, doubled after each failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout for each delivery request
+	Timeout time.Duration
+	// PollInterval how often pending deliveries are checked for
+	PollInterval time.Duration
+	// AllowHTTP accept webhook urls without tls
+	AllowHTTP bool
+	// AllowPrivate accept webhook urls that resolve to loopback, private or link local addresses
+	AllowPrivate bool
+}
+
+func (c *WebhookConfig) getConfigFromENV() error {
+	maxAttempts, err := getIntFromENV("WEBHOOK_MAX_ATTEMPTS", 8)
+	if err != nil {
+		return err
+	}
+	c.MaxAttempts = maxAttempts
+
+	backoff, err := getDurationFromENV("WEBHOOK_BACKOFF", 10*time.Second)
+	if err != nil {
+		return err
+	}
+	c.Backoff = backoff
+
+	maxBackoff, err := getDurationFromENV("WEBHOOK_MAX_BACKOFF", time.Hour)
+	if err != nil {
+		return err
+	}
+	c.MaxBackoff = maxBackoff
+
+	timeout, err := getDurationFromENV("WEBHOOK_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+	c.Timeout = timeout
+
+	pollInterval, err := getDurationFromENV("WEBHOOK_POLL_INTERVAL", 5*time.Second)
+	if err != nil {
+		return err
+	}
+	c.PollInterval = pollInterval
+
+	allowHTTP, err := getBoolFromENV("WEBHOOK_ALLOW_HTTP", false)
+	if err != nil {
+		return err
+	}
+	c.AllowHTTP = allowHTTP
+
+	allowPrivate, err := getBoolFromENV("WEBHOOK_ALLOW_PRIVATE", false)
+	if err != nil {
+		return err
+	}
+	c.AllowPrivate = allowPrivate
+	return nil
+}
+
+// RetryAfter how long to wait before retrying a delivery that has failed attempts times
+func (c *WebhookConfig) RetryAfter(attempts int) time.Duration {
+	wait := c.Backoff
+	for i := 1; i < attempts && wait < c.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > c.MaxBackoff {
+		wait = c.MaxBackoff
+	}
+	return wait
+}
+
+// the sinks the outbox relay can publish events to
+const (
+	OutboxSinkWebhook = "webhook"
+	OutboxSinkNotify  = "notify"
+	OutboxSinkLog     = "log"
+)
+
+type OutboxConfig struct {
+	// Sinks where the relay publishes events
+	Sinks []string
+	// BatchSize number of events published in each transaction
+	BatchSize int
+	// PollInterval how often the outbox is checked for events recorded by other instances
+	PollInterval time.Duration
+}
+
+func (c *OutboxConfig) getConfigFromENV() error {
+	c.Sinks = splitList(getStringFromENV("OUTBOX_SINKS", OutboxSinkWebhook+","+OutboxSinkNotify))
+	for _, sink := range c.Sinks {
+		if sink != OutboxSinkWebhook && sink != OutboxSinkNotify && sink != OutboxSinkLog {
+			return fmt.Errorf("unknown outbox sink %s", sink)
+		}
+	}
+
+	batchSize, err := getIntFromENV("OUTBOX_BATCH_SIZE", 100)
+	if err != nil {
+		return err
+	}
+	c.BatchSize = batchSize
+
+	pollInterval, err := getDurationFromENV("OUTBOX_POLL_INTERVAL", time.Second)
+	if err != nil {
+		return err
+	}
+	c.PollInterval = pollInterval
+	return nil
+}
+
+type GroupConfig struct {
+	// Live check group membership when messages are read rather than copying the members to the recipients when they are
+	// sent
+	Live bool
+}
+
+func (c *GroupConfig) getConfigFromENV() error {
+	switch membership := getStringFromENV("GROUP_MEMBERSHIP", "expand"); membership {
+	case "expand":
+		c.Live = false
+	case "live":
+		c.Live = true
+	default:
+		return fmt.Errorf("unknown group membership %s", membership)
+	}
+	return nil
+}
+
+type BlockConfig struct {
+	// DropBlocked send messages to the other recipients rather than rejecting them when a recipient has blocked the sender
+	DropBlocked bool
+	// HideMuted leave messages from muted users out of the message list rather than flagging them
+	HideMuted bool
+}
+
+func (c *BlockConfig) getConfigFromENV() error {
+	switch blocked := getStringFromENV("BLOCKED_RECIPIENTS", "reject"); blocked {
+	case "reject":
+		c.DropBlocked = false
+	case "drop":
+		c.DropBlocked = true
+	default:
+		return fmt.Errorf("unknown blocked recipients handling %s", blocked)
+	}
+
+	switch muted := getStringFromENV("MUTED_MESSAGES", "hide"); muted {
+	case "hide":
+		c.HideMuted = true
+	case "flag":
+		c.HideMuted = false
+	default:
+		return fmt.Errorf("unknown muted messages handling %s", muted)
+	}
+	return nil
+}
+
+type MentionConfig struct {
+	// AddRecipients add mentioned users that are not recipients to the recipients rather than rejecting the message
+	AddRecipients bool
+}
+
+func (c *MentionConfig) getConfigFromENV() error {
+	switch mentioned := getStringFromENV("MENTIONED_USERS", "reject"); mentioned {
+	case "reject":
+		c.AddRecipients = false
+	case "add":
+		c.AddRecipients = true
+	default:
+		return fmt.Errorf("unknown mentioned users handling %s", mentioned)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	// EventMessageCreated sent to the owner when they create a message or draft
+	EventMessageCreated = "message_created"
+	// EventMessageEdited sent to everyone who can see the message
+	EventMessageEdited = "message_edited"
+	// EventMessageDeleted sent to everyone who could see the message
+	EventMessageDeleted = "message_deleted"
+	// EventRecipientAdded sent to each recipient when a message is sent to them
+	EventRecipientAdded = "recipient_added"
+	// EventMessageRead sent to the owner when a recipient first gets the message
+	EventMessageRead = "message_read"
+	// EventMentioned sent to a recipient when a sent message first mentions them
+	EventMentioned = "mentioned"
+)
+
+// EventTypes every type of event
+var EventTypes = []string{EventMessageCreated, EventMessageEdited, EventMessageDeleted, EventRecipientAdded, EventMessageRead, EventMentioned}
+
+// EventPositions sequence the relay takes event positions from
+const EventPositions = "event_positions"
+
+// Event change to a message delivered to one user. Events are written in the same transaction as the change and act as
+// an outbox for the relay to publish, they are kept after publishing so clients can resume after reconnecting.
+type Event struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"index" json:"-"`
+	Type      string
+	MessageID uint
+	// PublishedAt when the relay published the event to the sinks
+	PublishedAt *time.Time `gorm:"index:idx_events_unpublished,where:published_at IS NULL" json:"-"`
+	// Position order the event was published in, clients resume from the position of the last event they saw. Ids are
+	// taken when the event is written so they can commit out of order, positions are only taken by the relay one batch
+	// at a time so a position is never committed before a lower one. Zero until the event is published.
+	Position uint64 `gorm:"index"`
+}
+
+// EventTicket single use ticket that opens one event connection, for clients that can not set the authorization header
+// when opening a websocket or event source
+type EventTicket struct {
+	Ticket    string `gorm:"primaryKey"`
+	UserID    uint   `json:"-"`
+	ExpiresAt time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// Provenance the message a forward was made from, recorded when it is forwarded so later edits to or deletion of the
+// original do not change it
+type Provenance struct {
+	MessageID uint
+	OwnerID   uint
+	CreatedAt time.Time
+}
+
+// Value marshal the provenance to json for the db
+func (p Provenance) Value() (driver.Value, error) {
+	return jsonValue(p, false)
+}
+
+// Scan unmarshal the provenance from the json in the db
+func (p *Provenance) Scan(value interface{}) error {
+	return jsonScan(value, p)
+}
+
+// ForwardRequest who to forward a message to, at least one recipient or group is needed
+type ForwardRequest struct {
+	Recipients []User `validate:"required_without=GroupIDs"`
+	GroupIDs   []uint `validate:"required_without=Recipients"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// the changes to a group's membership recorded in its audit log
+const (
+	GroupCreated  = "group_created"
+	GroupDeleted  = "group_deleted"
+	MemberAdded   = "member_added"
+	MemberRemoved = "member_removed"
+	AdminGranted  = "admin_granted"
+	AdminRevoked  = "admin_revoked"
+)
+
+// Group user owned list of users that can be sent messages together
+type Group struct {
+	ID        uint          `gorm:"primarykey"`
+	CreatedAt time.Time     `json:"-"`
+	UpdatedAt time.Time     `json:"-"`
+	OwnerID   uint          `gorm:"index"`
+	Owner     *User         `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Name      string        `validate:"required,max=100"`
+	Members   []GroupMember `gorm:"constraint:OnDelete:CASCADE;" validate:"dive"`
+}
+
+// GroupMember user in a group, admins can change the members
+type GroupMember struct {
+	GroupID   uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"primaryKey;index" validate:"required"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	CreatedAt time.Time `json:"-"`
+	Admin     bool
+}
+
+// MessageGroup group a message was sent to. Live groups are checked when the message is read so the current members see
+// it, otherwise the members are copied to the recipients when the message is sent.
+type MessageGroup struct {
+	MessageID uint   `gorm:"primaryKey"`
+	GroupID   uint   `gorm:"primaryKey;index"`
+	Group     *Group `gorm:"constraint:OnDelete:CASCADE;"`
+	Live      bool
+}
+
+// GroupAudit change to a group's membership, kept after the group is deleted
+type GroupAudit struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	GroupID   uint `gorm:"index"`
+	// ActorID user that made the change
+	ActorID uint
+	// UserID member that was changed
+	UserID uint
+	Action string
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonValue marshal a value to json for a jsonb column, nil values are stored as null
+func jsonValue(v interface{}, isNil bool) (driver.Value, error) {
+	if isNil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// jsonScan unmarshal a jsonb column into dest
+func jsonScan(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("failed to scan json from %T", value)
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Label personal tag a user can apply to the messages they see. A folder is a label that can only be applied once to
+// each message, applying a folder moves the message out of the user's other folders.
+type Label struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_labels_user_name" json:"-"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Name      string    `gorm:"uniqueIndex:idx_labels_user_name" validate:"required,max=50"`
+	Folder    bool
+}
+
+// MessageLabel label a user applied to a message
+type MessageLabel struct {
+	MessageID uint     `gorm:"primaryKey"`
+	LabelID   uint     `gorm:"primaryKey;index"`
+	UserID    uint     `gorm:"index"`
+	Message   *Message `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Label     *Label   `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Star message a user has starred
+type Star struct {
+	MessageID uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+	Message   *Message `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	User      *User    `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// LabelRequest messages to apply a label to or remove it from
+type LabelRequest struct {
+	MessageIDs []uint `validate:"required,min=1,max=500"`
+}
+
+// MessageFilter narrow the messages listed for a user
+type MessageFilter struct {
+	// Analysis only messages where all the named analyzers had a positive result
+	Analysis []string
+	// LabelID only messages the user applied the label to
+	LabelID uint
+	// Starred only messages the user starred
+	Starred bool
+	// Mentioned only messages that mention the user
+	Mentioned bool
+}
+
+// Scope scope a query to the messages matching the filter for the user
+func (f *MessageFilter) Scope(userId uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(HasAnalysis(f.Analysis))
+		if f.LabelID != 0 {
+			db = db.Where("EXISTS (SELECT 1 FROM message_labels ml WHERE ml.message_id = messages.id AND ml.label_id = ? AND ml.user_id = ?)", f.LabelID, userId)
+		}
+		if f.Starred {
+			db = db.Where("EXISTS (SELECT 1 FROM stars s WHERE s.message_id = messages.id AND s.user_id = ?)", userId)
+		}
+		if f.Mentioned {
+			db = db.Where("EXISTS (SELECT 1 FROM mentions mn WHERE mn.message_id = messages.id AND mn.user_id = ?)", userId)
+		}
+		return db
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql/driver"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MentionEntity @username token in the text of a message resolved to a user, Start and End are rune offsets covering the
+// @ and the username
+type MentionEntity struct {
+	UserID   uint
+	Username string
+	Start    int
+	End      int
+}
+
+// MentionEntities stored as jsonb
+type MentionEntities []MentionEntity
+
+// Value marshal the mentions to json for the db
+func (m MentionEntities) Value() (driver.Value, error) {
+	return jsonValue(m, m == nil)
+}
+
+// Scan unmarshal the mentions from the json in the db
+func (m *MentionEntities) Scan(value interface{}) error {
+	return jsonScan(value, m)
+}
+
+// Mention user mentioned in a message, kept so users can list the messages that mention them
+type Mention struct {
+	MessageID uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+	Message   *Message `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	User      *User    `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// isMentionRune check if a rune can be part of a mentioned username
+func isMentionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' || r == '.' || r == '-'
+}
+
+// FindMentions find the @username tokens in a text. An @ only starts a mention at the start of the text or after a rune
+// that can not be part of a username, so email addresses are not mentions, and trailing dots and dashes are left out as
+// punctuation. The mentions are not resolved to users.
+func FindMentions(text string) MentionEntities {
+	var mentions MentionEntities
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isMentionRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isMentionRune(runes[end]) {
+			end++
+		}
+		username := strings.TrimRight(string(runes[i+1:end]), ".-")
+		if username == "" {
+			continue
+		}
+		end = i + 1 + len([]rune(username))
+		mentions = append(mentions, MentionEntity{Username: username, Start: i, End: end})
+		i = end - 1
+	}
+	return mentions
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindMentions(t *testing.T) {
+	mentions := FindMentions("@alice and @bob.smith, see @carol.")
+
+	expected := MentionEntities{
+		{Username: "alice", Start: 0, End: 6},
+		{Username: "bob.smith", Start: 11, End: 21},
+		{Username: "carol", Start: 27, End: 33},
+	}
+	if !reflect.DeepEqual(expected, mentions) {
+		t.Errorf("wrong mentions expected %v actual %v", expected, mentions)
+	}
+}
+
+func TestFindMentionsMultiByte(t *testing.T) {
+	mentions := FindMentions("été @zoë")
+
+	expected := MentionEntities{{Username: "zoë", Start: 4, End: 8}}
+	if !reflect.DeepEqual(expected, mentions) {
+		t.Errorf("wrong mentions expected %v actual %v", expected, mentions)
+	}
+}
+
+func TestFindMentionsEmail(t *testing.T) {
+	mentions := FindMentions("mail alice@example.com or @ nobody")
+
+	if mentions != nil {
+		t.Errorf("email addresses and a lone @ are not mentions %v", mentions)
+	}
+}
@@ -6,28 +6,105 @@ import (
 )
 
 type Message struct {
-	ID         uint           `gorm:"primarykey"`
-	CreatedAt  time.Time      `json:"-"`
-	UpdatedAt  time.Time      `json:"-"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
-	OwnerID    uint
-	Text       string `validate:"required"`
-	Palindrome bool
-	Recipients []User `gorm:"many2many:recipients;"`
-}
-
-// isPalindrome check if a string is a palindrome
-func isPalindrome(s string) bool {
-	palindrome := true
-	numC := len(s)
-	//check string from both ends
-	for i := 0; i < numC/2; i++ {
-		palindrome = palindrome && s[i] == s[numC-i-1]
+	ID                   uint           `gorm:"primarykey"`
+	CreatedAt            time.Time      `json:"-"`
+	UpdatedAt            time.Time      `json:"-"`
+	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
+	OwnerID              uint
+	Text                 string `validate:"required"`
+	Palindrome           bool
+	PalindromeNormalised bool
+	Analysis             Analysis        `gorm:"type:jsonb"`
+	LongestPalindromes   PalindromeSpans `gorm:"type:jsonb"`
+	AnalysisVersion      uint            `gorm:"index"`
+	// AnagramKey sorted letters of the text so the db can find anagrams
+	AnagramKey  string     `gorm:"index" json:"-"`
+	ExpiresAt   *time.Time `gorm:"index"`
+	TTL         uint       `gorm:"-" json:",omitempty"`
+	ViewOnce    bool
+	Draft       bool
+	Recipients  []User           `gorm:"many2many:recipients;"`
+	GroupIDs    []uint           `gorm:"-" json:",omitempty"`
+	Attachments []Attachment     `gorm:"constraint:OnDelete:CASCADE;" json:",omitempty"`
+	Reactions   map[string]int64 `gorm:"-" json:",omitempty"`
+	// Muted the owner is muted by the user getting the message
+	Muted bool `gorm:"-" json:",omitempty"`
+	// Labels and Starred how the user getting the message has organised it
+	Labels  []uint `gorm:"-" json:",omitempty"`
+	Starred bool   `gorm:"-" json:",omitempty"`
+	// ForwardedFrom the original message if this message is a forward
+	ForwardedFrom *Provenance `gorm:"type:jsonb" json:",omitempty"`
+	// Mentions the users mentioned in the text
+	Mentions MentionEntities `gorm:"type:jsonb" json:",omitempty"`
+}
+
+// Recipient join table between a message and the users it was sent to
+type Recipient struct {
+	MessageID uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey"`
+	// ReadAt when the recipient first got the message
+	ReadAt    *time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// NotExpired scope a query to messages that have not reached their expiry time
+func NotExpired(db *gorm.DB) *gorm.DB {
+	return db.Where("(messages.expires_at IS NULL OR messages.expires_at > ?)", time.Now())
+}
+
+// liveGroupMember condition that the message was sent to a live group the user is a member of and the user has not
+// blocked the owner
+const liveGroupMember = "EXISTS (SELECT 1 FROM message_groups mg JOIN group_members gm ON mg.group_id = gm.group_id " +
+	"WHERE mg.message_id = messages.id AND mg.live AND gm.user_id = ? " +
+	"AND NOT EXISTS (SELECT 1 FROM blocks b WHERE b.user_id = gm.user_id AND b.blocked_id = messages.owner_id))"
+
+// VisibleTo scope a query to sent messages the user received and has not removed or was sent through a live group they are
+// a member of, along with all messages the user owns
+func VisibleTo(userId uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(NotExpired).
+			Joins("LEFT JOIN recipients r ON messages.id = r.message_id AND r.user_id = ? AND r.deleted_at IS NULL", userId).
+			Where("(((r.user_id IS NOT NULL OR "+liveGroupMember+") AND NOT messages.draft) OR messages.owner_id = ?)", userId, userId)
 	}
-	return palindrome
 }
 
-// Check all word play types
-func (m *Message) Check() {
+// Check all word play types with the enabled analyzers and find the longest palindromes to highlight
+func (m *Message) Check(config *AnalysisConfig) {
+	m.Analysis = Analyze(config, m.Text)
+	m.LongestPalindromes = findLongestPalindromes(m.Text)
+	m.AnagramKey = AnagramKey(config, m.Text)
+	m.AnalysisVersion = AnalysisVersion
+	//palindrome results are also kept in their own columns for existing clients, even if the analyzers are disabled
 	m.Palindrome = isPalindrome(m.Text)
+	m.PalindromeNormalised = isPalindrome(normalise(config, m.Text))
+}
+
+// HideViewOnce clear the content of a view once message for a recipient, only getting the message by id shows the
+// content and it removes the message for the recipient at the same time
+func (m *Message) HideViewOnce(userId uint) {
+	if m.ViewOnce && m.OwnerID != userId {
+		m.Text = ""
+		m.Palindrome = false
+		m.PalindromeNormalised = false
+		m.Analysis = nil
+		m.LongestPalindromes = nil
+		m.Mentions = nil
+		m.Attachments = nil
+	}
+}
+
+// SetExpiry convert the ttl in seconds from user input to an expiry time
+func (m *Message) SetExpiry(now time.Time) {
+	if m.TTL > 0 {
+		expiresAt := now.Add(time.Duration(m.TTL) * time.Second)
+		m.ExpiresAt = &expiresAt
+		m.TTL = 0
+	}
+}
+
+// SearchResult message matching a full text search along with its rank and a snippet with the matches highlighted
+type SearchResult struct {
+	Message
+	Rank    float32
+	Snippet string
 }
@@ -1,6 +1,19 @@
 package models
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var analysisConfig = AnalysisConfig{
+	FoldCase:          true,
+	StripAccents:      true,
+	IgnorePunctuation: true,
+	IgnoreWhitespace:  true,
+	Alphabet:          "abcdefghijklmnopqrstuvwxyz",
+	LipogramLetter:    "e",
+}
 
 func TestMessage_CheckPalindromeOdd(t *testing.T) {
 	message := Message{
@@ -8,7 +21,7 @@ func TestMessage_CheckPalindromeOdd(t *testing.T) {
 		Palindrome: false,
 	}
 
-	message.Check()
+	message.Check(&analysisConfig)
 
 	if !message.Palindrome {
 		t.Errorf("massage is a palindrome")
@@ -21,7 +34,7 @@ func TestMessage_CheckPalindromeEven(t *testing.T) {
 		Palindrome: false,
 	}
 
-	message.Check()
+	message.Check(&analysisConfig)
 
 	if !message.Palindrome {
 		t.Errorf("massage is a palindrome")
@@ -33,9 +46,158 @@ func TestMessage_CheckNotPalindrome(t *testing.T) {
 		Palindrome: true,
 	}
 
-	message.Check()
+	message.Check(&analysisConfig)
 
 	if message.Palindrome {
 		t.Errorf("massage is not a palindrome")
 	}
 }
+
+func TestMessage_CheckPalindromeDisabled(t *testing.T) {
+	config := analysisConfig
+	config.DisabledAnalyzers = []string{"palindrome", "palindrome_normalised"}
+	message := Message{
+		Text: "Race car",
+	}
+
+	message.Check(&config)
+
+	if message.Palindrome || !message.PalindromeNormalised {
+		t.Errorf("palindrome columns not set with the analyzers disabled %v %v", message.Palindrome, message.PalindromeNormalised)
+	}
+}
+
+func TestMessage_CheckPalindromeMultiByte(t *testing.T) {
+	message := Message{
+		Text: "été",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Palindrome || !message.PalindromeNormalised {
+		t.Errorf("message is a palindrome")
+	}
+}
+
+func TestMessage_CheckPalindromeCombiningMarks(t *testing.T) {
+	message := Message{
+		// e followed by a combining acute accent at both ends
+		Text: "e\u0301te\u0301",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Palindrome {
+		t.Errorf("message is a palindrome")
+	}
+}
+
+func TestMessage_CheckPalindromeNormalisedCase(t *testing.T) {
+	message := Message{
+		Text: "Racecar",
+	}
+
+	message.Check(&analysisConfig)
+
+	if message.Palindrome {
+		t.Errorf("message is not a strict palindrome")
+	}
+	if !message.PalindromeNormalised {
+		t.Errorf("message is a normalised palindrome")
+	}
+}
+
+func TestMessage_CheckPalindromeNormalisedPunctuation(t *testing.T) {
+	message := Message{
+		Text: "A man, a plan, a canal: Panama",
+	}
+
+	message.Check(&analysisConfig)
+
+	if message.Palindrome {
+		t.Errorf("message is not a strict palindrome")
+	}
+	if !message.PalindromeNormalised {
+		t.Errorf("message is a normalised palindrome")
+	}
+}
+
+func TestMessage_CheckPalindromeNormalisedAccents(t *testing.T) {
+	message := Message{
+		Text: "étè",
+	}
+
+	message.Check(&analysisConfig)
+
+	if message.Palindrome {
+		t.Errorf("message is not a strict palindrome")
+	}
+	if !message.PalindromeNormalised {
+		t.Errorf("message is a normalised palindrome")
+	}
+}
+
+func TestMessage_CheckPalindromeNormalisationDisabled(t *testing.T) {
+	message := Message{
+		Text: "A man, a plan, a canal: Panama",
+	}
+
+	message.Check(&AnalysisConfig{})
+
+	if message.PalindromeNormalised {
+		t.Errorf("message is not a palindrome without normalisation")
+	}
+}
+
+func TestMessage_CheckLongestPalindromes(t *testing.T) {
+	message := Message{
+		Text: "noon or abba",
+	}
+
+	message.Check(&analysisConfig)
+
+	expected := PalindromeSpans{{Start: 0, End: 4, Text: "noon"}, {Start: 8, End: 12, Text: "abba"}}
+	if !reflect.DeepEqual(expected, message.LongestPalindromes) {
+		t.Errorf("wrong longest palindromes expected %v actual %v", expected, message.LongestPalindromes)
+	}
+}
+
+func TestMessage_CheckLongestPalindromesSingleGrapheme(t *testing.T) {
+	message := Message{
+		Text: "abc",
+	}
+
+	message.Check(&analysisConfig)
+
+	if message.LongestPalindromes != nil {
+		t.Errorf("single graphemes should not be highlighted %v", message.LongestPalindromes)
+	}
+}
+
+func TestMessage_SetExpiry(t *testing.T) {
+	now := time.Now()
+	message := Message{
+		Text: "test",
+		TTL:  60,
+	}
+
+	message.SetExpiry(now)
+
+	if message.ExpiresAt == nil || !message.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("message expiry time is wrong %v", message.ExpiresAt)
+	} else if message.TTL != 0 {
+		t.Errorf("message ttl was not cleared")
+	}
+}
+
+func TestMessage_SetExpiryNoTTL(t *testing.T) {
+	message := Message{
+		Text: "test",
+	}
+
+	message.SetExpiry(time.Now())
+
+	if message.ExpiresAt != nil {
+		t.Errorf("message without ttl should not expire")
+	}
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"database/sql/driver"
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+func init() {
+	RegisterAnalyzer(palindromeAnalyzer{})
+	RegisterAnalyzer(normalisedPalindromeAnalyzer{})
+	RegisterAnalyzer(wordPalindromeAnalyzer{})
+	RegisterAnalyzer(sentencePalindromeAnalyzer{})
+	RegisterAnalyzer(semordnilapAnalyzer{})
+}
+
+// palindromeAnalyzer text reads the same backwards without any normalisation
+type palindromeAnalyzer struct{}
+
+func (palindromeAnalyzer) Name() string {
+	return "palindrome"
+}
+
+func (palindromeAnalyzer) Analyze(_ *AnalysisConfig, text string) AnalysisResult {
+	return AnalysisResult{Result: isPalindrome(text)}
+}
+
+// normalisedPalindromeAnalyzer text reads the same backwards after normalisation
+type normalisedPalindromeAnalyzer struct{}
+
+func (normalisedPalindromeAnalyzer) Name() string {
+	return "palindrome_normalised"
+}
+
+func (normalisedPalindromeAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	return AnalysisResult{Result: isPalindrome(normalise(config, text))}
+}
+
+// wordPalindromeAnalyzer words of the text read the same in reverse order
+type wordPalindromeAnalyzer struct{}
+
+func (wordPalindromeAnalyzer) Name() string {
+	return "word_palindrome"
+}
+
+func (wordPalindromeAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	return AnalysisResult{Result: isUnitPalindrome(words(config, text))}
+}
+
+// sentencePalindromeAnalyzer lines or sentences of the text read the same in reverse order
+type sentencePalindromeAnalyzer struct{}
+
+func (sentencePalindromeAnalyzer) Name() string {
+	return "sentence_palindrome"
+}
+
+func (sentencePalindromeAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	var sentences []string
+	for _, sentence := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == '\n' || r == '.' || r == '!' || r == '?'
+	}) {
+		if normalised := strings.Join(words(config, sentence), " "); normalised != "" {
+			sentences = append(sentences, normalised)
+		}
+	}
+	return AnalysisResult{Result: isUnitPalindrome(sentences)}
+}
+
+// semordnilapAnalyzer text reversed forms different dictionary words
+type semordnilapAnalyzer struct{}
+
+func (semordnilapAnalyzer) Name() string {
+	return "semordnilap"
+}
+
+func (semordnilapAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	forwards := strings.Join(words(config, text), " ")
+	clusters := graphemes(forwards)
+	for i, j := 0, len(clusters)-1; i < j; i, j = i+1, j-1 {
+		clusters[i], clusters[j] = clusters[j], clusters[i]
+	}
+	backwards := strings.Join(clusters, "")
+
+	//reading the same backwards makes it a palindrome not a semordnilap
+	if forwards == "" || forwards == backwards || !config.InDictionary(forwards) || !config.InDictionary(backwards) {
+		return AnalysisResult{Result: false}
+	}
+	return AnalysisResult{Result: true, Details: map[string]interface{}{"reversed": backwards}}
+}
+
+// words split the text into words after folding case and stripping accents as configured
+func words(config *AnalysisConfig, text string) []string {
+	//keep whitespace and punctuation so the word boundaries survive normalisation
+	wordConfig := *config
+	wordConfig.IgnoreWhitespace = false
+	wordConfig.IgnorePunctuation = false
+	return strings.FieldsFunc(normalise(&wordConfig, text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.Is(unicode.Mn, r)
+	})
+}
+
+// isUnitPalindrome check if there are multiple units and they read the same in reverse order
+func isUnitPalindrome(units []string) bool {
+	if len(units) < 2 {
+		return false
+	}
+	for i, j := 0, len(units)-1; i < j; i, j = i+1, j-1 {
+		if units[i] != units[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// graphemes split a string into user perceived characters so combining marks stay with their base
+func graphemes(s string) []string {
+	var clusters []string
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		//compose each grapheme so precomposed and decomposed characters compare equal
+		clusters = append(clusters, norm.NFC.String(g.Str()))
+	}
+	return clusters
+}
+
+// graphemeOffsets get the rune offset where each grapheme starts followed by the total number of runes
+func graphemeOffsets(s string) []int {
+	offsets := []int{0}
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		offsets = append(offsets, offsets[len(offsets)-1]+len(g.Runes()))
+	}
+	return offsets
+}
+
+// longestPalindromes find every longest run of graphemes that is a palindrome using Manacher's algorithm,
+// returns the grapheme index of the start and the index after the end of each run in order
+func longestPalindromes(clusters []string) [][2]int {
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	//interleave separators so even and odd length palindromes both have a centre, graphemes are never empty
+	t := make([]string, 2*len(clusters)+1)
+	for i, cluster := range clusters {
+		t[2*i+1] = cluster
+	}
+
+	//radius[i] is the radius of the palindrome centred on t[i] which is also its length in graphemes
+	radius := make([]int, len(t))
+	centre, right := 0, 0
+	longest := 0
+	for i := range t {
+		if i < right {
+			radius[i] = radius[2*centre-i]
+			if right-i < radius[i] {
+				radius[i] = right - i
+			}
+		}
+		for i-radius[i]-1 >= 0 && i+radius[i]+1 < len(t) && t[i-radius[i]-1] == t[i+radius[i]+1] {
+			radius[i]++
+		}
+		if i+radius[i] > right {
+			centre, right = i, i+radius[i]
+		}
+		if radius[i] > longest {
+			longest = radius[i]
+		}
+	}
+
+	//every palindrome has its own centre so there are no duplicates
+	var runs [][2]int
+	for i, r := range radius {
+		if r == longest {
+			start := (i - r) / 2
+			runs = append(runs, [2]int{start, start + r})
+		}
+	}
+	return runs
+}
+
+// PalindromeSpan part of a text by rune offsets, End is the offset after the last rune
+type PalindromeSpan struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// PalindromeSpans stored as jsonb
+type PalindromeSpans []PalindromeSpan
+
+// Value marshal the spans to json for the db
+func (p PalindromeSpans) Value() (driver.Value, error) {
+	return jsonValue(p, p == nil)
+}
+
+// Scan unmarshal the spans from the json in the db
+func (p *PalindromeSpans) Scan(value interface{}) error {
+	return jsonScan(value, p)
+}
+
+// span get the span covering graphemes start to end
+func span(runes []rune, offsets []int, start int, end int) PalindromeSpan {
+	return PalindromeSpan{
+		Start: offsets[start],
+		End:   offsets[end],
+		Text:  string(runes[offsets[start]:offsets[end]]),
+	}
+}
+
+// findLongestPalindromes get the spans of every longest palindrome in the text that is at least two graphemes long
+func findLongestPalindromes(text string) PalindromeSpans {
+	runes := []rune(text)
+	offsets := graphemeOffsets(text)
+
+	var spans PalindromeSpans
+	for _, run := range longestPalindromes(graphemes(text)) {
+		//every single grapheme is a palindrome so they are not worth highlighting
+		if run[1]-run[0] < 2 {
+			break
+		}
+		spans = append(spans, span(runes, offsets, run[0], run[1]))
+	}
+	return spans
+}
+
+// isPalindrome check if a string reads the same backwards one grapheme at a time
+func isPalindrome(s string) bool {
+	clusters := graphemes(s)
+	//check string from both ends
+	for i, j := 0, len(clusters)-1; i < j; i, j = i+1, j-1 {
+		if clusters[i] != clusters[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalise apply the configured normalisation to a string before word play checks
+func normalise(config *AnalysisConfig, s string) string {
+	if config.FoldCase {
+		s = cases.Fold().String(s)
+	}
+
+	if config.StripAccents {
+		//decompose so accents become separate marks that can be dropped
+		s = norm.NFKD.String(s)
+	} else {
+		s = norm.NFKC.String(s)
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case config.StripAccents && unicode.Is(unicode.Mn, r):
+			return -1
+		case config.IgnorePunctuation && (unicode.IsPunct(r) || unicode.IsSymbol(r)):
+			return -1
+		case config.IgnoreWhitespace && unicode.IsSpace(r):
+			return -1
+		default:
+			return r
+		}
+	}, s)
+}
@@ -0,0 +1,28 @@
+//go:build go1.18
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func FuzzLongestPalindromes(f *testing.F) {
+	for _, seed := range []string{"", "a", "ab", "aa", "racecar", "noon or abba", "ééabbaé", "ée", "🇨🇦🇨🇦", "abcba abba"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		clusters := graphemes(text)
+		//the oracle is cubic so keep the input small
+		if len(clusters) > 64 {
+			t.Skip()
+		}
+
+		expected := bruteLongestPalindromes(clusters)
+		actual := longestPalindromes(clusters)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("wrong longest palindromes for %q expected %v actual %v", text, expected, actual)
+		}
+	})
+}
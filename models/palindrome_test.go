@@ -0,0 +1,48 @@
+package models
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// longestPalindromesSeeds inputs the longest palindromes are checked against the oracle with
+var longestPalindromesSeeds = []string{"", "a", "ab", "aa", "racecar", "noon or abba", "ééabbaé", "ée", "🇨🇦🇨🇦", "abcba abba"}
+
+// bruteLongestPalindromes check every run of graphemes to find the longest palindromes
+func bruteLongestPalindromes(clusters []string) [][2]int {
+	var runs [][2]int
+	for length := len(clusters); length > 0 && runs == nil; length-- {
+		for start := 0; start+length <= len(clusters); start++ {
+			if isUnitPalindrome(clusters[start:start+length]) || length == 1 {
+				runs = append(runs, [2]int{start, start + length})
+			}
+		}
+	}
+	return runs
+}
+
+func TestLongestPalindromesOracle(t *testing.T) {
+	texts := append([]string{}, longestPalindromesSeeds...)
+
+	//a small alphabet with combining marks and flags so random strings contain palindromes and multi rune graphemes
+	alphabet := []string{"a", "b", "c", " ", "é", "é", "🇨🇦"}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		var builder strings.Builder
+		for j := random.Intn(24); j > 0; j-- {
+			builder.WriteString(alphabet[random.Intn(len(alphabet))])
+		}
+		texts = append(texts, builder.String())
+	}
+
+	for _, text := range texts {
+		clusters := graphemes(text)
+		expected := bruteLongestPalindromes(clusters)
+		actual := longestPalindromes(clusters)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("wrong longest palindromes for %q expected %v actual %v", text, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type Reaction struct {
+	MessageID uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"primaryKey"`
+	Emoji     string    `gorm:"primaryKey" validate:"required,max=32"`
+	CreatedAt time.Time `json:"-"`
+	Message   *Message  `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
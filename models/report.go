@@ -0,0 +1,40 @@
+package models
+
+type AnalysisRequest struct {
+	Text string `validate:"required,max=10000"`
+}
+
+// AnalysisReport detailed word play analysis of a text that is not stored
+type AnalysisReport struct {
+	Text       string
+	Normalised string
+	Analysis   Analysis
+	// Centre grapheme the text mirrors around, or an empty span between the middle graphemes for even lengths
+	Centre            PalindromeSpan
+	LongestPalindrome PalindromeSpan
+}
+
+// NewAnalysisReport run the same analyzers as Message.Check on the text and find its centre and longest palindrome
+func NewAnalysisReport(config *AnalysisConfig, text string) *AnalysisReport {
+	runes := []rune(text)
+	clusters := graphemes(text)
+	offsets := graphemeOffsets(text)
+
+	middle := len(clusters) / 2
+	centre := span(runes, offsets, middle, middle)
+	if len(clusters)%2 == 1 {
+		centre = span(runes, offsets, middle, middle+1)
+	}
+
+	report := &AnalysisReport{
+		Text:       text,
+		Normalised: normalise(config, text),
+		Analysis:   Analyze(config, text),
+		Centre:     centre,
+	}
+	//empty text has no longest palindrome, any other text has at least one grapheme
+	if runs := longestPalindromes(clusters); len(runs) > 0 {
+		report.LongestPalindrome = span(runes, offsets, runs[0][0], runs[0][1])
+	}
+	return report
+}
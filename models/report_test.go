@@ -0,0 +1,71 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewAnalysisReport_LongestPalindrome(t *testing.T) {
+	report := NewAnalysisReport(&analysisConfig, "my racecar!")
+
+	expected := PalindromeSpan{Start: 3, End: 10, Text: "racecar"}
+	if !reflect.DeepEqual(expected, report.LongestPalindrome) {
+		t.Errorf("wrong longest palindrome expected %v actual %v", expected, report.LongestPalindrome)
+	}
+}
+
+func TestNewAnalysisReport_LongestPalindromeMultiByte(t *testing.T) {
+	// offsets are in runes so the two byte é characters only count once
+	report := NewAnalysisReport(&analysisConfig, "ééabbaé")
+
+	expected := PalindromeSpan{Start: 1, End: 7, Text: "éabbaé"}
+	if !reflect.DeepEqual(expected, report.LongestPalindrome) {
+		t.Errorf("wrong longest palindrome expected %v actual %v", expected, report.LongestPalindrome)
+	}
+}
+
+func TestNewAnalysisReport_Empty(t *testing.T) {
+	report := NewAnalysisReport(&analysisConfig, "")
+
+	expected := PalindromeSpan{}
+	if !reflect.DeepEqual(expected, report.LongestPalindrome) || !reflect.DeepEqual(expected, report.Centre) {
+		t.Errorf("wrong spans for empty text longest palindrome %v centre %v", report.LongestPalindrome, report.Centre)
+	}
+}
+
+func TestNewAnalysisReport_Punctuation(t *testing.T) {
+	report := NewAnalysisReport(&analysisConfig, "?!")
+
+	expected := PalindromeSpan{Start: 0, End: 1, Text: "?"}
+	if !reflect.DeepEqual(expected, report.LongestPalindrome) {
+		t.Errorf("wrong longest palindrome expected %v actual %v", expected, report.LongestPalindrome)
+	}
+}
+
+func TestNewAnalysisReport_CentreOdd(t *testing.T) {
+	report := NewAnalysisReport(&analysisConfig, "abcde")
+
+	expected := PalindromeSpan{Start: 2, End: 3, Text: "c"}
+	if !reflect.DeepEqual(expected, report.Centre) {
+		t.Errorf("wrong centre expected %v actual %v", expected, report.Centre)
+	}
+}
+
+func TestNewAnalysisReport_CentreEven(t *testing.T) {
+	report := NewAnalysisReport(&analysisConfig, "abba")
+
+	expected := PalindromeSpan{Start: 2, End: 2, Text: ""}
+	if !reflect.DeepEqual(expected, report.Centre) {
+		t.Errorf("wrong centre expected %v actual %v", expected, report.Centre)
+	}
+}
+
+func TestNewAnalysisReport_Analysis(t *testing.T) {
+	report := NewAnalysisReport(&analysisConfig, "Racecar")
+
+	if !reflect.DeepEqual(Analyze(&analysisConfig, "Racecar"), report.Analysis) {
+		t.Errorf("report analysis is not the same as the message analysis %v", report.Analysis)
+	} else if report.Normalised != "racecar" {
+		t.Errorf("wrong normalised text %s", report.Normalised)
+	}
+}
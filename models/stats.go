@@ -0,0 +1,66 @@
+package models
+
+// UserStatsView materialised view aggregating each user's sent messages so stats do not scan the messages table.
+// A streak is a run of consecutive palindromes, the current streak is the run ending at the user's latest message.
+// Messages that have expired by the time the view is refreshed and forwards of other messages are not counted.
+const UserStatsView = `CREATE MATERIALIZED VIEW IF NOT EXISTS user_stats AS
+WITH sent AS (
+	SELECT owner_id, palindrome, char_length(text) AS length,
+		row_number() OVER (PARTITION BY owner_id ORDER BY created_at DESC, id DESC) AS recency,
+		row_number() OVER (PARTITION BY owner_id ORDER BY created_at DESC, id DESC) -
+		row_number() OVER (PARTITION BY owner_id, palindrome ORDER BY created_at DESC, id DESC) AS run
+	FROM messages
+	WHERE deleted_at IS NULL AND NOT draft AND forwarded_from IS NULL AND (expires_at IS NULL OR expires_at > now())
+), totals AS (
+	SELECT owner_id, count(*) AS messages, count(*) FILTER (WHERE palindrome) AS palindromes,
+		coalesce(max(length) FILTER (WHERE palindrome), 0) AS longest_palindrome
+	FROM sent
+	GROUP BY owner_id
+), streaks AS (
+	SELECT owner_id, max(length) AS longest_streak, coalesce(max(length) FILTER (WHERE latest = 1), 0) AS current_streak
+	FROM (SELECT owner_id, count(*) AS length, min(recency) AS latest FROM sent WHERE palindrome GROUP BY owner_id, run) runs
+	GROUP BY owner_id
+)
+SELECT users.id AS user_id, users.username, totals.messages, totals.palindromes,
+	totals.palindromes::float / totals.messages AS ratio, totals.longest_palindrome,
+	coalesce(streaks.current_streak, 0) AS current_streak, coalesce(streaks.longest_streak, 0) AS longest_streak
+FROM users
+JOIN totals ON totals.owner_id = users.id
+LEFT JOIN streaks ON streaks.owner_id = users.id
+WHERE users.deleted_at IS NULL`
+
+// UserStatsVersion version of the view recorded as its comment, bump it when the view or the messages columns it
+// depends on change so the view is dropped before the migration and recreated
+const UserStatsVersion = "1"
+
+// UserStatsViewVersion the version recorded on the existing view, empty if there is no view
+const UserStatsViewVersion = "SELECT coalesce(obj_description(to_regclass('user_stats'), 'pg_class'), '')"
+
+// DropUserStatsView drop the view so migrations can alter the columns it depends on, it is recreated from scratch
+const DropUserStatsView = "DROP MATERIALIZED VIEW IF EXISTS user_stats"
+
+// CommentUserStatsView record the version of the view so it is only recreated when it changes
+const CommentUserStatsView = "COMMENT ON MATERIALIZED VIEW user_stats IS '" + UserStatsVersion + "'"
+
+// UserStats palindrome statistics for a user who has sent at least one message
+type UserStats struct {
+	UserID      uint `gorm:"primaryKey"`
+	Username    string
+	Messages    int64
+	Palindromes int64
+	// Ratio fraction of the user's messages that are palindromes
+	Ratio float64
+	// LongestPalindrome length in characters of the user's longest palindrome message
+	LongestPalindrome int64
+	CurrentStreak     int64
+	LongestStreak     int64
+}
+
+// LeaderboardOrders columns the leaderboard can be ranked by, palindromes first for ties
+var LeaderboardOrders = map[string]string{
+	"palindromes":        "palindromes DESC",
+	"ratio":              "ratio DESC, palindromes DESC",
+	"longest_palindrome": "longest_palindrome DESC, palindromes DESC",
+	"current_streak":     "current_streak DESC, palindromes DESC",
+	"longest_streak":     "longest_streak DESC, palindromes DESC",
+}
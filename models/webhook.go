@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead given up on after the maximum number of attempts
+	DeliveryDead = "dead"
+)
+
+// StringList stored as jsonb
+type StringList []string
+
+// Value marshal the list to json for the db
+func (l StringList) Value() (driver.Value, error) {
+	return jsonValue(l, l == nil)
+}
+
+// Scan unmarshal the list from the json in the db
+func (l *StringList) Scan(value interface{}) error {
+	return jsonScan(value, l)
+}
+
+// Webhook url the user's events are posted to, signed with the secret
+type Webhook struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+	UserID    uint      `gorm:"index" json:"-"`
+	URL       string    `validate:"required,url,max=2048"`
+	// Secret key for the payload signatures, generated when the webhook is created and only returned then
+	Secret string `json:",omitempty" validate:"isdefault"`
+	// Events types of event to deliver, every type if empty
+	Events StringList `gorm:"type:jsonb" validate:"dive,oneof=message_created message_edited message_deleted recipient_added message_read mentioned"`
+	// AllUsers deliver the events of every user, only for admins
+	AllUsers bool
+}
+
+// Wants check if the webhook should get the event
+func (w *Webhook) Wants(event *Event) bool {
+	if !w.AllUsers && w.UserID != event.UserID {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, eventType := range w.Events {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPayload json posted to a webhook for an event
+type WebhookPayload struct {
+	EventID   uint
+	Type      string
+	MessageID uint
+	// UserID user the event is for, only differs from the webhook owner for admin webhooks
+	UserID    uint
+	CreatedAt time.Time
+}
+
+// WebhookDelivery attempts to post an event to a webhook, kept as a log of deliveries
+type WebhookDelivery struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// an event is only delivered once to each webhook however many times the outbox relays it
+	WebhookID uint     `gorm:"uniqueIndex:idx_webhook_deliveries_event"`
+	Webhook   *Webhook `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	EventID   uint     `gorm:"uniqueIndex:idx_webhook_deliveries_event"`
+	Type      string
+	Payload   string `json:"-"`
+	Status    string `gorm:"index"`
+	Attempts  int
+	// NextAttemptAt when a pending delivery is next tried
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    *time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookConfig_RetryAfter(t *testing.T) {
+	config := WebhookConfig{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+
+	for attempts, expected := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 40 * time.Second, 4: time.Minute, 20: time.Minute} {
+		if actual := config.RetryAfter(attempts); actual != expected {
+			t.Errorf("wrong wait after %d attempts expected %s actual %s", attempts, expected, actual)
+		}
+	}
+}
+
+func TestWebhook_Wants(t *testing.T) {
+	webhook := Webhook{UserID: 1, Events: StringList{EventMessageRead}}
+
+	if !webhook.Wants(&Event{UserID: 1, Type: EventMessageRead}) {
+		t.Errorf("webhook wants its user's read events")
+	} else if webhook.Wants(&Event{UserID: 1, Type: EventMessageEdited}) {
+		t.Errorf("webhook does not want edit events")
+	} else if webhook.Wants(&Event{UserID: 2, Type: EventMessageRead}) {
+		t.Errorf("webhook does not want other users' events")
+	}
+
+	webhook.AllUsers = true
+	if !webhook.Wants(&Event{UserID: 2, Type: EventMessageRead}) {
+		t.Errorf("admin webhook wants every user's events")
+	}
+}
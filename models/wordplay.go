@@ -0,0 +1,105 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+func init() {
+	RegisterAnalyzer(pangramAnalyzer{})
+	RegisterAnalyzer(isogramAnalyzer{})
+	RegisterAnalyzer(lipogramAnalyzer{})
+}
+
+// letters get the letters of the normalised text ignoring everything else
+func letters(config *AnalysisConfig, text string) []rune {
+	var runes []rune
+	for _, r := range normalise(config, text) {
+		if unicode.IsLetter(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+// pangramAnalyzer text uses every letter of the configured alphabet
+type pangramAnalyzer struct{}
+
+func (pangramAnalyzer) Name() string {
+	return "pangram"
+}
+
+func (pangramAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	used := map[rune]bool{}
+	for _, r := range letters(config, text) {
+		used[r] = true
+	}
+
+	var missing []rune
+	for _, r := range normalise(config, config.Alphabet) {
+		if !used[r] {
+			missing = append(missing, r)
+		}
+	}
+
+	if len(missing) > 0 {
+		return AnalysisResult{Result: false, Details: map[string]interface{}{"missing": string(missing)}}
+	}
+	return AnalysisResult{Result: true}
+}
+
+// isogramAnalyzer text has letters and none of them are repeated
+type isogramAnalyzer struct{}
+
+func (isogramAnalyzer) Name() string {
+	return "isogram"
+}
+
+func (isogramAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	runes := letters(config, text)
+
+	seen := map[rune]bool{}
+	var repeated []rune
+	for _, r := range runes {
+		if seen[r] && !strings.ContainsRune(string(repeated), r) {
+			repeated = append(repeated, r)
+		}
+		seen[r] = true
+	}
+
+	if len(repeated) > 0 {
+		return AnalysisResult{Result: false, Details: map[string]interface{}{"repeated": string(repeated)}}
+	}
+	return AnalysisResult{Result: len(runes) > 0}
+}
+
+// lipogramAnalyzer text has letters but never uses the configured letter
+type lipogramAnalyzer struct{}
+
+func (lipogramAnalyzer) Name() string {
+	return "lipogram"
+}
+
+func (lipogramAnalyzer) Analyze(config *AnalysisConfig, text string) AnalysisResult {
+	runes := letters(config, text)
+	letter := normalise(config, config.LipogramLetter)
+
+	result := len(runes) > 0 && !strings.Contains(string(runes), letter)
+	return AnalysisResult{Result: result, Details: map[string]interface{}{"letter": letter}}
+}
+
+// AnagramKey get the sorted letters of the normalised text, texts with the same key are anagrams
+func AnagramKey(config *AnalysisConfig, text string) string {
+	runes := letters(config, text)
+	sort.Slice(runes, func(i, j int) bool {
+		return runes[i] < runes[j]
+	})
+	return string(runes)
+}
+
+// IsAnagram check if two texts use the same letters in a different order
+func IsAnagram(config *AnalysisConfig, a string, b string) bool {
+	key := AnagramKey(config, a)
+	return key != "" && key == AnagramKey(config, b) && string(letters(config, a)) != string(letters(config, b))
+}
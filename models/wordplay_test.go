@@ -0,0 +1,163 @@
+package models
+
+import "testing"
+
+func TestMessage_CheckPangram(t *testing.T) {
+	message := Message{
+		Text: "The quick brown fox jumps over the lazy dog",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Analysis["pangram"].Result {
+		t.Errorf("message is a pangram %v", message.Analysis["pangram"])
+	}
+}
+
+func TestMessage_CheckNotPangram(t *testing.T) {
+	message := Message{
+		Text: "The quick brown fox jumps over the dog",
+	}
+
+	message.Check(&analysisConfig)
+
+	if result := message.Analysis["pangram"]; result.Result {
+		t.Errorf("message is not a pangram")
+	} else if result.Details["missing"] != "alyz" {
+		t.Errorf("wrong missing letters %v", result.Details)
+	}
+}
+
+func TestMessage_CheckIsogram(t *testing.T) {
+	message := Message{
+		Text: "Dermatoglyphics",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Analysis["isogram"].Result {
+		t.Errorf("message is an isogram")
+	}
+}
+
+func TestMessage_CheckNotIsogram(t *testing.T) {
+	message := Message{
+		Text: "Letter",
+	}
+
+	message.Check(&analysisConfig)
+
+	if result := message.Analysis["isogram"]; result.Result {
+		t.Errorf("message is not an isogram")
+	} else if result.Details["repeated"] != "te" {
+		t.Errorf("wrong repeated letters %v", result.Details)
+	}
+}
+
+func TestMessage_CheckLipogram(t *testing.T) {
+	message := Message{
+		Text: "A lipogram avoids a lot",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Analysis["lipogram"].Result {
+		t.Errorf("message is a lipogram")
+	}
+}
+
+func TestMessage_CheckNotLipogram(t *testing.T) {
+	message := Message{
+		Text: "Écrire",
+	}
+
+	message.Check(&analysisConfig)
+
+	if message.Analysis["lipogram"].Result {
+		t.Errorf("message is not a lipogram")
+	}
+}
+
+func TestIsAnagram(t *testing.T) {
+	if !IsAnagram(&analysisConfig, "Listen", "Silent!") {
+		t.Errorf("texts are anagrams")
+	}
+	if IsAnagram(&analysisConfig, "Listen", "Listen") {
+		t.Errorf("the same text is not an anagram")
+	}
+	if IsAnagram(&analysisConfig, "Listen", "Lists") {
+		t.Errorf("texts are not anagrams")
+	}
+}
+
+func TestMessage_CheckWordPalindrome(t *testing.T) {
+	message := Message{
+		Text: "Fall leaves after leaves fall.",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Analysis["word_palindrome"].Result {
+		t.Errorf("message is a word palindrome")
+	}
+	if message.Analysis["palindrome_normalised"].Result {
+		t.Errorf("message is not a character palindrome")
+	}
+}
+
+func TestMessage_CheckSentencePalindrome(t *testing.T) {
+	message := Message{
+		Text: "You can cage a swallow.\nCan't you?\nYou can cage a swallow.",
+	}
+
+	message.Check(&analysisConfig)
+
+	if !message.Analysis["sentence_palindrome"].Result {
+		t.Errorf("message is a sentence palindrome")
+	}
+	if message.Analysis["word_palindrome"].Result {
+		t.Errorf("message is not a word palindrome")
+	}
+}
+
+func TestMessage_CheckSemordnilap(t *testing.T) {
+	config := analysisConfig
+	config.LoadDictionary("stressed\nDesserts\nlive\non\nno\nevil\n")
+
+	message := Message{
+		Text: "Stressed",
+	}
+	message.Check(&config)
+	if result := message.Analysis["semordnilap"]; !result.Result || result.Details["reversed"] != "desserts" {
+		t.Errorf("message is a semordnilap %v", result)
+	}
+
+	message = Message{
+		Text: "Live on",
+	}
+	message.Check(&config)
+	if result := message.Analysis["semordnilap"]; !result.Result || result.Details["reversed"] != "no evil" {
+		t.Errorf("message is a semordnilap %v", result)
+	}
+}
+
+func TestMessage_CheckNotSemordnilap(t *testing.T) {
+	config := analysisConfig
+	config.LoadDictionary("level\nstressed\n")
+
+	message := Message{
+		Text: "level",
+	}
+	message.Check(&config)
+	if message.Analysis["semordnilap"].Result {
+		t.Errorf("palindrome is not a semordnilap")
+	}
+
+	message = Message{
+		Text: "stressed",
+	}
+	message.Check(&config)
+	if message.Analysis["semordnilap"].Result {
+		t.Errorf("message reversed is not in the dictionary")
+	}
+}
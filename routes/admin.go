@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// preHandlerAdmin standard handler setup for the admin routes, only users listed in the admin config are let through
+func preHandlerAdmin(c *fiber.Ctx) (*models.Config, *gorm.DB, hermesErrors.HermesError) {
+	config, db, userId, hermesError := preHandler(c, "admin")
+	if hermesError != nil {
+		return nil, nil, hermesError
+	}
+
+	user := models.User{}
+	result := db.Select("username").First(&user, userId)
+	if result.Error != nil || !config.AdminConfig.IsAdmin(user.Username) {
+		return nil, nil, hermesErrors.NotAdmin()
+	}
+	return config, db, nil
+}
+
+func getBackfill(c *fiber.Ctx) error {
+	_, db, hermesError := preHandlerAdmin(c)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	job, hermesError := controllers.GetBackfill(db)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(job)
+}
+
+func startBackfill(c *fiber.Ctx) error {
+	config, db, hermesError := preHandlerAdmin(c)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	// the body is optional, by default only messages from older analysis versions are analysed
+	request := new(models.BackfillRequest)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+	}
+
+	job, hermesError := controllers.StartBackfill(db, request)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	// the job outlives the request, progress is checked with get
+	go func() {
+		if _, hermesError := controllers.RunBackfill(db, config, job.ID); hermesError != nil {
+			hermesError.LogPrivate()
+		}
+	}()
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func Admin(app *fiber.App) {
+	route := app.Group("/admin")
+
+	route.Get("/backfill", getBackfill)
+	route.Post("/backfill", startBackfill)
+}
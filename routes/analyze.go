@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"strconv"
+)
+
+// rateLimit limit the number of requests for each user, the limiter runs before the handler checks the authorization
+// so requests without a valid token are limited by ip instead
+func rateLimit(jwtConfig *models.JWTConfig, config *models.RateLimitConfig) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        config.Max,
+		Expiration: config.Window,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			userId, hermesError := utils.ValidateAuth(jwtConfig, c.Get(fiber.HeaderAuthorization))
+			if hermesError != nil {
+				return "ip:" + c.IP()
+			}
+			return "user:" + strconv.FormatUint(uint64(userId), 10)
+		},
+	})
+}
+
+// preHandlerAnalyze standard handler setup get the analysis request from body
+func preHandlerAnalyze(c *fiber.Ctx, request *models.AnalysisRequest) (*models.Config, hermesErrors.HermesError) {
+	config, err := models.GetConfig()
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err))
+	}
+
+	// check user authorization from authorization header
+	_, hermesError := utils.ValidateAuth(&config.JWTConfig, c.Get(fiber.HeaderAuthorization))
+	if hermesError != nil {
+		return nil, hermesError.Wrap("failed on pre handler for analyze\n")
+	}
+
+	if err := c.BodyParser(request); err != nil {
+		return nil, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err)).Wrap("failed on pre handler for analyze\n")
+	}
+	if hermesError := utils.Validate(request); hermesError != nil {
+		return nil, hermesError.Wrap("failed on pre handler for analyze\n")
+	}
+	return config, nil
+}
+
+func analyze(c *fiber.Ctx) error {
+	request := new(models.AnalysisRequest)
+	config, hermesError := preHandlerAnalyze(c, request)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	return c.JSON(controllers.Analyze(config, request))
+}
+
+func Analyze(app *fiber.App, config *models.Config) {
+	app.Post("/analyze", rateLimit(&config.JWTConfig, &config.AnalyzeRateLimit), analyze)
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/storage"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// preHandlerAttachment standard message handler setup along with the blob store
+func preHandlerAttachment(c *fiber.Ctx) (*models.Config, *gorm.DB, storage.BlobStore, uint, hermesErrors.HermesError) {
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		return nil, nil, nil, 0, hermesError.Wrap("failed on pre handler for attachment\n")
+	}
+
+	store, err := storage.GetBlobStore(&config.AttachmentConfig.BlobStore)
+	if err != nil {
+		return nil, nil, nil, 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get blob store %s\n", err)).Wrap("failed on pre handler for attachment\n")
+	}
+	return config, db, store, userId, nil
+}
+
+func addAttachment(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	config, db, store, userId, hermesError := preHandlerAttachment(c)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to get file from form: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	attachment, hermesError := controllers.AddAttachment(db, store, &config.AttachmentConfig, file, messageId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(attachment)
+}
+
+func getAttachment(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	attachmentId, err := c.ParamsInt("attachmentId")
+	if err != nil {
+		return err
+	}
+
+	_, db, store, userId, hermesError := preHandlerAttachment(c)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	attachment, blob, hermesError := controllers.GetAttachment(db, store, messageId, attachmentId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", attachment.Filename))
+	// the stream is closed by fasthttp once it has been sent
+	return c.SendStream(blob, int(attachment.Size))
+}
+
+func Attachment(app *fiber.App) {
+	route := app.Group("/message/:id/attachment")
+
+	route.Post("", addAttachment)
+	route.Get("/:attachmentId", getAttachment)
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// blockHandler run a block or mute controller on the user in the path
+func blockHandler(controller func(db *gorm.DB, otherId uint, userId uint) (fiber.Map, hermesErrors.HermesError)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		otherId, err := c.ParamsInt("userId")
+		if err != nil {
+			return err
+		}
+
+		_, db, userId, hermesError := preHandler(c, "block")
+		if hermesError != nil {
+			hermesError.LogPrivate()
+			return hermesError
+		}
+
+		result, hermesError := controller(db, uint(otherId), userId)
+		if hermesError != nil {
+			hermesError.LogPrivate()
+			return hermesError
+		}
+		return c.JSON(result)
+	}
+}
+
+// blockListHandler run a controller listing the user's blocked or muted users
+func blockListHandler(controller func(db *gorm.DB, userId uint) (fiber.Map, hermesErrors.HermesError)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		_, db, userId, hermesError := preHandler(c, "block")
+		if hermesError != nil {
+			hermesError.LogPrivate()
+			return hermesError
+		}
+
+		result, hermesError := controller(db, userId)
+		if hermesError != nil {
+			hermesError.LogPrivate()
+			return hermesError
+		}
+		return c.JSON(result)
+	}
+}
+
+func Block(app *fiber.App) {
+	block := app.Group("/block")
+	block.Get("", blockListHandler(controllers.GetBlocks))
+	block.Post("/:userId", blockHandler(controllers.AddBlock))
+	block.Delete("/:userId", blockHandler(controllers.RemoveBlock))
+
+	mute := app.Group("/mute")
+	mute.Get("", blockListHandler(controllers.GetMutes))
+	mute.Post("/:userId", blockHandler(controllers.AddMute))
+	mute.Delete("/:userId", blockHandler(controllers.RemoveMute))
+}
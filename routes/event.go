@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/events"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"strconv"
+	"time"
+)
+
+// writeWait time allowed to send a ping before the connection is considered dead
+const writeWait = 10 * time.Second
+
+// authenticateEvents check the user authorization and parse the position to resume after, browsers can not set headers
+// when opening a websocket or event source so a ticket from POST /message/ticket can be passed in the ticket query
+// parameter instead. Tickets are single use and short lived so they are safe to end up in access logs.
+func authenticateEvents(c *fiber.Ctx) error {
+	config, err := models.GetConfig()
+	if err != nil {
+		return hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err))
+	}
+
+	var userId uint
+	var hermesError hermesErrors.HermesError
+	if authorization := c.Get(fiber.HeaderAuthorization); authorization != "" || c.Query("ticket") == "" {
+		userId, hermesError = utils.ValidateAuth(&config.JWTConfig, authorization)
+	} else {
+		db, connectionError := utils.Connection(&config.DBConfig)
+		if connectionError != nil {
+			connectionError.LogPrivate()
+			return connectionError
+		}
+		userId, hermesError = controllers.UseEventTicket(db, c.Query("ticket"))
+	}
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	c.Locals("userId", userId)
+
+	// server sent event clients resume with a header, websockets can only use the query
+	lastEventIdInput := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	lastEventId := uint64(0)
+	if lastEventIdInput != "" {
+		if lastEventId, err = strconv.ParseUint(lastEventIdInput, 10, 64); err != nil {
+			hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser last event id: %s\n", err))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+	}
+	c.Locals("lastEventId", lastEventId)
+	return c.Next()
+}
+
+func addEventTicket(c *fiber.Ctx) error {
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	ticket, hermesError := controllers.AddEventTicket(db, &config.EventConfig, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(ticket)
+}
+
+// upgradeEvents only let websocket handshakes through to the socket handler
+func upgradeEvents(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	return c.Next()
+}
+
+// streamEvents send the user's stored events after the position of the last event then their live events until sending
+// fails or done is closed, heartbeat is called every heartbeat interval. Returns true if the user fell too far behind
+// and should resume from their last event.
+func streamEvents(userId uint, lastEventId uint64, send func(event models.Event) error, heartbeat func() error, done <-chan struct{}) bool {
+	config, err := models.GetConfig()
+	if err != nil {
+		hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err)).LogPrivate()
+		return false
+	}
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return false
+	}
+
+	// subscribe before replaying so nothing is missed in between, duplicates are skipped by position
+	hub := events.GetHub()
+	subscription := hub.Subscribe(userId)
+	defer hub.Unsubscribe(subscription)
+
+	missed, hermesError := controllers.GetEvents(db, userId, lastEventId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return false
+	}
+	for _, event := range missed {
+		if err := send(event); err != nil {
+			return false
+		}
+		lastEventId = event.Position
+	}
+
+	ticker := time.NewTicker(config.EventConfig.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return true
+			}
+			if event.Position <= lastEventId {
+				continue
+			}
+			if err := send(event); err != nil {
+				return false
+			}
+			lastEventId = event.Position
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return false
+			}
+		case <-done:
+			return false
+		}
+	}
+}
+
+// messageSocket push the user's message events over a websocket
+func messageSocket(c *websocket.Conn) {
+	config, err := models.GetConfig()
+	if err != nil {
+		hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err)).LogPrivate()
+		return
+	}
+
+	// the client does not send anything, reading handles pongs and closes
+	heartbeat := config.EventConfig.HeartbeatInterval
+	_ = c.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	behind := streamEvents(c.Locals("userId").(uint), c.Locals("lastEventId").(uint64),
+		func(event models.Event) error {
+			return c.WriteJSON(event)
+		},
+		func() error {
+			return c.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		},
+		closed,
+	)
+	if behind {
+		// the client reconnects and resumes from the stored events
+		_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "resume from last event"), time.Now().Add(writeWait))
+	}
+}
+
+// writeServerSentEvent write the event in the text/event-stream format and flush it to the client
+func writeServerSentEvent(w *bufio.Writer, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Position, event.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// messageStream push the user's message events as server sent events for clients that can not use websockets
+func messageStream(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(uint)
+	lastEventId := c.Locals("lastEventId").(uint64)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// stop nginx from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// a closed connection is noticed when a write fails, at the latest on the next keepalive
+		behind := streamEvents(userId, lastEventId,
+			func(event models.Event) error {
+				return writeServerSentEvent(w, event)
+			},
+			func() error {
+				if _, err := w.WriteString(": keepalive\n\n"); err != nil {
+					return err
+				}
+				return w.Flush()
+			},
+			nil,
+		)
+		if behind {
+			// the browser reconnects with the last event id after the stream ends
+			_, _ = w.WriteString(": resume from last event\n\n")
+			_ = w.Flush()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func addGroup(c *fiber.Ctx) error {
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	group := new(models.Group)
+	if err := c.BodyParser(group); err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	if hermesError = utils.Validate(group); hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	group, hermesError = controllers.AddGroup(db, group, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(group)
+}
+
+func getGroups(c *fiber.Ctx) error {
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	groups, hermesError := controllers.GetGroups(db, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(groups)
+}
+
+func getGroup(c *fiber.Ctx) error {
+	groupId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	group, hermesError := controllers.GetGroup(db, groupId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(group)
+}
+
+func deleteGroup(c *fiber.Ctx) error {
+	groupId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.DeleteGroup(db, groupId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func setMember(c *fiber.Ctx) error {
+	groupId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	member := new(models.GroupMember)
+	if err := c.BodyParser(member); err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	if hermesError = utils.Validate(member); hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	group, hermesError := controllers.SetMember(db, groupId, member, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(group)
+}
+
+func removeMember(c *fiber.Ctx) error {
+	groupId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	memberId, err := c.ParamsInt("userId")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.RemoveMember(db, groupId, uint(memberId), userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func getGroupAudit(c *fiber.Ctx) error {
+	groupId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "group")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	entries, hermesError := controllers.GetGroupAudit(db, groupId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(entries)
+}
+
+func Group(app *fiber.App) {
+	route := app.Group("/group")
+
+	route.Post("", addGroup)
+	route.Get("", getGroups)
+	route.Get("/:id", getGroup)
+	route.Delete("/:id", deleteGroup)
+	route.Post("/:id/member", setMember)
+	route.Delete("/:id/member/:userId", removeMember)
+	route.Get("/:id/audit", getGroupAudit)
+}
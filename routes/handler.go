@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// preHandler standard handler setup for the authenticated routes, check user authorization from authorization header
+// and open the db connection, errors are wrapped with the name of the route
+func preHandler(c *fiber.Ctx, route string) (*models.Config, *gorm.DB, uint, hermesErrors.HermesError) {
+	config, err := models.GetConfig()
+	if err != nil {
+		return nil, nil, 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err))
+	}
+
+	// check user authorization from authorization header
+	userId, hermesError := utils.ValidateAuth(&config.JWTConfig, c.Get(fiber.HeaderAuthorization))
+	if hermesError != nil {
+		return nil, nil, 0, hermesError.Wrap(fmt.Sprintf("failed on pre handler for %s\n", route))
+	}
+
+	// open db connection
+	db, hermesError := utils.Connection(&config.DBConfig)
+	if hermesError != nil {
+		return nil, nil, 0, hermesError.Wrap(fmt.Sprintf("failed on pre handler for %s\n", route))
+	}
+	return config, db, userId, nil
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// preHandlerLabel standard handler setup for the authenticated label routes, get input from body if out is not nil
+func preHandlerLabel(c *fiber.Ctx, out interface{}) (*gorm.DB, uint, hermesErrors.HermesError) {
+	_, db, userId, hermesError := preHandler(c, "label")
+	if hermesError != nil {
+		return nil, 0, hermesError
+	}
+
+	if out != nil {
+		if err := c.BodyParser(out); err != nil {
+			return nil, 0, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err)).Wrap("failed on pre handler for label\n")
+		}
+		if hermesError := utils.Validate(out); hermesError != nil {
+			return nil, 0, hermesError.Wrap("failed on pre handler for label\n")
+		}
+	}
+	return db, userId, nil
+}
+
+func addLabel(c *fiber.Ctx) error {
+	label := new(models.Label)
+	db, userId, hermesError := preHandlerLabel(c, label)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	label, hermesError = controllers.AddLabel(db, label, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(label)
+}
+
+func getLabels(c *fiber.Ctx) error {
+	db, userId, hermesError := preHandlerLabel(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	labels, hermesError := controllers.GetLabels(db, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(labels)
+}
+
+func editLabel(c *fiber.Ctx) error {
+	labelId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	label := new(models.Label)
+	db, userId, hermesError := preHandlerLabel(c, label)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	label, hermesError = controllers.EditLabel(db, labelId, label, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(label)
+}
+
+func deleteLabel(c *fiber.Ctx) error {
+	labelId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	db, userId, hermesError := preHandlerLabel(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.DeleteLabel(db, labelId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func applyLabel(c *fiber.Ctx) error {
+	labelId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	request := new(models.LabelRequest)
+	db, userId, hermesError := preHandlerLabel(c, request)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.ApplyLabel(db, labelId, request, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func removeLabel(c *fiber.Ctx) error {
+	labelId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	request := new(models.LabelRequest)
+	db, userId, hermesError := preHandlerLabel(c, request)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.RemoveLabel(db, labelId, request, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func Label(app *fiber.App) {
+	route := app.Group("/label")
+
+	route.Post("", addLabel)
+	route.Get("", getLabels)
+	route.Post("/:id", editLabel)
+	route.Delete("/:id", deleteLabel)
+	route.Post("/:id/apply", applyLabel)
+	route.Post("/:id/remove", removeLabel)
+}
@@ -3,57 +3,64 @@ package routes
 import (
 	"fmt"
 	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/events"
 	"github.com/Daniel-W-Innes/hermes/hermesErrors"
 	"github.com/Daniel-W-Innes/hermes/models"
 	"github.com/Daniel-W-Innes/hermes/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // preHandlerMessage standard handler setup get message from body message par is not nil
-func preHandlerMessage(c *fiber.Ctx, message *models.Message) (*gorm.DB, uint, hermesErrors.HermesError) {
+func preHandlerMessage(c *fiber.Ctx, message *models.Message) (*models.Config, *gorm.DB, uint, hermesErrors.HermesError) {
 	config, err := models.GetConfig()
 	if err != nil {
-		return nil, 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err))
+		return nil, nil, 0, hermesErrors.InternalServerError(fmt.Sprintf("failed to get config %s\n", err))
 	}
 
 	// check user authorization from authorization header
 	authorization := c.Get(fiber.HeaderAuthorization)
 	userId, hermesError := utils.ValidateAuth(&config.JWTConfig, authorization)
 	if hermesError != nil {
-		return nil, 0, hermesError.Wrap("failed on pre handler for message\n")
+		return nil, nil, 0, hermesError.Wrap("failed on pre handler for message\n")
 	}
 
 	db, hermesError := utils.Connection(&config.DBConfig)
 	if hermesError != nil {
-		return nil, 0, hermesError.Wrap("failed on pre handler for message\n")
+		return nil, nil, 0, hermesError.Wrap("failed on pre handler for message\n")
 	}
 
 	// get user input from body if a destination is provided for it
 	if message != nil {
 		if err := c.BodyParser(message); err != nil {
-			return nil, 0, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err)).Wrap("failed on pre handler for message\n")
+			return nil, nil, 0, hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err)).Wrap("failed on pre handler for message\n")
 		}
 
-		// validate user inputted message
-		err := utils.Validate(message)
-		if err != nil {
-			return nil, 0, err.Wrap("failed on pre handler for message\n")
+		// validate user inputted message, drafts are validated when they are sent
+		if !message.Draft {
+			err := utils.Validate(message)
+			if err != nil {
+				return nil, nil, 0, err.Wrap("failed on pre handler for message\n")
+			}
 		}
 
 	}
-	return db, userId, nil
+	return config, db, userId, nil
 }
 
 func addMessage(c *fiber.Ctx) error {
 	message := new(models.Message)
-	db, userId, hermesError := preHandlerMessage(c, message)
+	config, db, userId, hermesError := preHandlerMessage(c, message)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
 	}
 
-	output, hermesError := controllers.AddMessage(db, message, userId)
+	output, hermesError := controllers.AddMessage(db, config, message, userId)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
@@ -67,7 +74,7 @@ func deleteMessage(c *fiber.Ctx) error {
 		return err
 	}
 
-	db, userId, hermesError := preHandlerMessage(c, nil)
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
@@ -82,13 +89,42 @@ func deleteMessage(c *fiber.Ctx) error {
 }
 
 func getMessages(c *fiber.Ctx) error {
-	db, userId, hermesError := preHandlerMessage(c, nil)
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
 	}
 
-	message, hermesError := controllers.GetMessages(db, userId)
+	// filter by analyzers with a positive result and by how the user organised the messages
+	filter := models.MessageFilter{}
+	if c.Query("analysis") != "" {
+		filter.Analysis = strings.Split(c.Query("analysis"), ",")
+	}
+	if c.Query("label") != "" {
+		labelId, err := strconv.ParseUint(c.Query("label"), 10, 64)
+		if err != nil {
+			hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parse label %s\n", err))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+		filter.LabelID = uint(labelId)
+	}
+	if c.Query("starred") != "" {
+		starred, err := strconv.ParseBool(c.Query("starred"))
+		if err != nil {
+			hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parse starred %s\n", err))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+		filter.Starred = starred
+	}
+
+	// long poll for new messages if the client has a cursor or wants to wait
+	if c.Query("since") != "" || c.Query("wait") != "" {
+		return pollMessages(c, config, db, userId, &filter)
+	}
+
+	message, hermesError := controllers.GetMessages(db, config, userId, &filter)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
@@ -96,13 +132,43 @@ func getMessages(c *fiber.Ctx) error {
 	return c.JSON(message)
 }
 
+func pollMessages(c *fiber.Ctx, config *models.Config, db *gorm.DB, userId uint, filter *models.MessageFilter) error {
+	var since uint64
+	var err error
+	if c.Query("since") != "" {
+		since, err = strconv.ParseUint(c.Query("since"), 10, 64)
+		if err != nil {
+			hermesError := hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parse since %s\n", err))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+	}
+
+	var wait time.Duration
+	if c.Query("wait") != "" {
+		wait, err = time.ParseDuration(c.Query("wait"))
+		if err != nil || wait < 0 {
+			hermesError := hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parse wait %s\n", c.Query("wait")))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+	}
+
+	messages, hermesError := controllers.PollMessages(db, config, events.GetHub(), userId, since, wait, filter)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(messages)
+}
+
 func getMessage(c *fiber.Ctx) error {
 	messageId, err := c.ParamsInt("id")
 	if err != nil {
 		return err
 	}
 
-	db, userId, hermesError := preHandlerMessage(c, nil)
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
@@ -122,13 +188,130 @@ func editMessage(c *fiber.Ctx) error {
 		return err
 	}
 
-	db, userId, hermesError := preHandlerMessage(c, nil)
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	message, hermesError := controllers.EditMessage(db, config, c.BodyParser, messageId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(message)
+}
+
+func getDrafts(c *fiber.Ctx) error {
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	messages, hermesError := controllers.GetDrafts(db, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(messages)
+}
+
+func sendMessage(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	message, hermesError := controllers.SendMessage(db, config, messageId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(message)
+}
+
+func searchMessages(c *fiber.Ctx) error {
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	messages, hermesError := controllers.SearchMessages(db, config, c.Query("q"), userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(messages)
+}
+
+func getMentions(c *fiber.Ctx) error {
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	messages, hermesError := controllers.GetMessages(db, config, userId, &models.MessageFilter{Mentioned: true})
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(messages)
+}
+
+func starMessage(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	// starring is a post and unstarring a delete on the same path
+	result, hermesError := controllers.StarMessage(db, messageId, c.Method() == fiber.MethodPost, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func forwardMessage(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	config, db, userId, hermesError := preHandlerMessage(c, nil)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
 	}
 
-	message, hermesError := controllers.EditMessage(db, c.BodyParser, messageId, userId)
+	request := new(models.ForwardRequest)
+	if err := c.BodyParser(request); err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	if hermesError = utils.Validate(request); hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	message, hermesError := controllers.ForwardMessage(db, config, messageId, request, userId)
 	if hermesError != nil {
 		hermesError.LogPrivate()
 		return hermesError
@@ -136,12 +319,49 @@ func editMessage(c *fiber.Ctx) error {
 	return c.JSON(message)
 }
 
+func batchMessages(c *fiber.Ctx) error {
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	request := new(models.BatchRequest)
+	if err := c.BodyParser(request); err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	if hermesError = utils.Validate(request); hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	results, hermesError := controllers.BatchMessages(db, request, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(results)
+}
+
 func Message(app *fiber.App) {
 	route := app.Group("/message")
 
 	route.Post("", addMessage)
 	route.Delete("/:id", deleteMessage)
 	route.Get("", getMessages)
+	route.Get("/drafts", getDrafts)
+	route.Get("/search", searchMessages)
+	route.Get("/mentions", getMentions)
+	route.Post("/ticket", addEventTicket)
+	route.Get("/ws", authenticateEvents, upgradeEvents, websocket.New(messageSocket))
+	route.Get("/stream", authenticateEvents, messageStream)
+	route.Post("/batch", batchMessages)
 	route.Get("/:id", getMessage)
 	route.Post("/:id", editMessage)
+	route.Post("/:id/send", sendMessage)
+	route.Post("/:id/forward", forwardMessage)
+	route.Post("/:id/star", starMessage)
+	route.Delete("/:id/star", starMessage)
 }
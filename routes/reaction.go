@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+	"net/url"
+)
+
+func addReaction(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	reaction := new(models.Reaction)
+	if err := c.BodyParser(reaction); err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	if hermesError = utils.Validate(reaction); hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	reactions, hermesError := controllers.AddReaction(db, reaction, messageId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(reactions)
+}
+
+func removeReaction(c *fiber.Ctx) error {
+	messageId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	// emoji are not url safe so they arrive escaped
+	emoji, err := url.PathUnescape(c.Params("emoji"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "emoji is not correctly escaped")
+	}
+
+	_, db, userId, hermesError := preHandlerMessage(c, nil)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	reactions, hermesError := controllers.RemoveReaction(db, emoji, messageId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(reactions)
+}
+
+func Reaction(app *fiber.App) {
+	route := app.Group("/message/:id/reaction")
+
+	route.Post("", addReaction)
+	route.Delete("/:emoji", removeReaction)
+}
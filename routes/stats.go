@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+)
+
+func getStats(c *fiber.Ctx) error {
+	_, db, userId, hermesError := preHandler(c, "stats")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	stats, hermesError := controllers.GetStats(db, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(stats)
+}
+
+func getLeaderboard(c *fiber.Ctx) error {
+	config, db, _, hermesError := preHandler(c, "stats")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	limit := config.StatsConfig.LeaderboardSize
+	if c.Query("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(c.Query("limit")); err != nil || limit < 1 {
+			hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser leaderboard limit: %s\n", c.Query("limit")))
+			hermesError.LogPrivate()
+			return hermesError
+		}
+	}
+
+	leaderboard, hermesError := controllers.GetLeaderboard(db, c.Query("by", "palindromes"), limit)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(leaderboard)
+}
+
+func Stats(app *fiber.App) {
+	route := app.Group("/stats")
+
+	route.Get("/me", getStats)
+	route.Get("/leaderboard", getLeaderboard)
+}
@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/controllers"
+	"github.com/Daniel-W-Innes/hermes/hermesErrors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"github.com/Daniel-W-Innes/hermes/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func addWebhook(c *fiber.Ctx) error {
+	config, db, userId, hermesError := preHandler(c, "webhook")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	webhook := new(models.Webhook)
+	if err := c.BodyParser(webhook); err != nil {
+		hermesError = hermesErrors.UnprocessableEntity(fmt.Sprintf("failed to parser user input: %s\n", err))
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	if hermesError = utils.Validate(webhook); hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	webhook, hermesError = controllers.AddWebhook(db, config, webhook, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(webhook)
+}
+
+func getWebhooks(c *fiber.Ctx) error {
+	_, db, userId, hermesError := preHandler(c, "webhook")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	webhooks, hermesError := controllers.GetWebhooks(db, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(webhooks)
+}
+
+func deleteWebhook(c *fiber.Ctx) error {
+	webhookId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "webhook")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.DeleteWebhook(db, webhookId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func getDeliveries(c *fiber.Ctx) error {
+	webhookId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "webhook")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	deliveries, hermesError := controllers.GetDeliveries(db, webhookId, userId, c.Query("status"))
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(deliveries)
+}
+
+func retryDelivery(c *fiber.Ctx) error {
+	webhookId, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+	deliveryId, err := c.ParamsInt("deliveryId")
+	if err != nil {
+		return err
+	}
+
+	_, db, userId, hermesError := preHandler(c, "webhook")
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+
+	result, hermesError := controllers.RetryDelivery(db, webhookId, deliveryId, userId)
+	if hermesError != nil {
+		hermesError.LogPrivate()
+		return hermesError
+	}
+	return c.JSON(result)
+}
+
+func Webhook(app *fiber.App) {
+	route := app.Group("/webhook")
+
+	route.Post("", addWebhook)
+	route.Get("", getWebhooks)
+	route.Delete("/:id", deleteWebhook)
+	route.Get("/:id/delivery", getDeliveries)
+	route.Post("/:id/delivery/:deliveryId/retry", retryDelivery)
+}
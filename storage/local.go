@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore BlobStore backed by a directory on the local filesystem
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore create a LocalStore rooted at path, creating the directory if necessary
+func NewLocalStore(path string) (*LocalStore, error) {
+	err := os.MkdirAll(path, 0o750)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: path}, nil
+}
+
+// path get the file path for a key, sharded by the first two characters to keep directories small
+func (l *LocalStore) path(key string) string {
+	if len(key) > 2 {
+		return filepath.Join(l.root, key[:2], key)
+	}
+	return filepath.Join(l.root, key)
+}
+
+func (l *LocalStore) Put(key string, r io.Reader, _ int64, _ string) error {
+	path := l.path(key)
+
+	// blobs are content addressed so an existing file already has the same content
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a partial write is never visible under the key
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *LocalStore) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (l *LocalStore) Delete(key string) error {
+	err := os.Remove(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLocalStore_PutGet(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Logf("failed to create local store %s", err)
+		t.FailNow()
+	}
+
+	data := []byte("test attachment")
+	err = store.Put("abcdef", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Logf("failed to put blob %s", err)
+		t.FailNow()
+	}
+
+	blob, err := store.Get("abcdef")
+	if err != nil {
+		t.Logf("failed to get blob %s", err)
+		t.FailNow()
+	}
+	defer blob.Close()
+
+	actual, err := io.ReadAll(blob)
+	if err != nil {
+		t.Logf("failed to read blob %s", err)
+		t.FailNow()
+	}
+	if !bytes.Equal(data, actual) {
+		t.Errorf("blob is not the same expected %s actual %s", data, actual)
+	}
+}
+
+func TestLocalStore_GetMissing(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Logf("failed to create local store %s", err)
+		t.FailNow()
+	}
+
+	_, err = store.Get("abcdef")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing blob returned the wrong error %s", err)
+	}
+}
+
+func TestLocalStore_Delete(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Logf("failed to create local store %s", err)
+		t.FailNow()
+	}
+
+	data := []byte("test attachment")
+	err = store.Put("abcdef", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Logf("failed to put blob %s", err)
+		t.FailNow()
+	}
+
+	err = store.Delete("abcdef")
+	if err != nil {
+		t.Logf("failed to delete blob %s", err)
+		t.FailNow()
+	}
+
+	_, err = store.Get("abcdef")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted blob returned the wrong error %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"io"
+	"os"
+	"testing"
+)
+
+// getS3Store connect to the S3 server from env, for example a local MinIO, or skip the test
+func getS3Store(t *testing.T) *S3Store {
+	if os.Getenv("S3_ENDPOINT") == "" {
+		t.Skip("S3_ENDPOINT is not set")
+	}
+
+	config, err := models.GetConfig()
+	if err != nil {
+		t.Logf("failed to get config %s", err)
+		t.FailNow()
+	}
+
+	store, err := NewS3Store(&config.AttachmentConfig.BlobStore)
+	if err != nil {
+		t.Logf("failed to create s3 store %s", err)
+		t.FailNow()
+	}
+	return store
+}
+
+func TestS3Store_PutGetDelete(t *testing.T) {
+	store := getS3Store(t)
+
+	data := []byte("test attachment")
+	err := store.Put("test-put-get-delete", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Logf("failed to put blob %s", err)
+		t.FailNow()
+	}
+
+	blob, err := store.Get("test-put-get-delete")
+	if err != nil {
+		t.Logf("failed to get blob %s", err)
+		t.FailNow()
+	}
+	actual, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		t.Logf("failed to read blob %s", err)
+		t.FailNow()
+	}
+	if !bytes.Equal(data, actual) {
+		t.Errorf("blob is not the same expected %s actual %s", data, actual)
+	}
+
+	err = store.Delete("test-put-get-delete")
+	if err != nil {
+		t.Logf("failed to delete blob %s", err)
+		t.FailNow()
+	}
+
+	_, err = store.Get("test-put-get-delete")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted blob returned the wrong error %s", err)
+	}
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"io"
+	"sync"
+)
+
+// ErrNotFound returned by a BlobStore when no blob is stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore content addressed storage for attachment data
+type BlobStore interface {
+	// Put store size bytes from r under key, storing the same key twice must be safe
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get open the blob stored under key
+	Get(key string) (io.ReadCloser, error)
+	// Delete remove the blob stored under key
+	Delete(key string) error
+}
+
+var lock = &sync.Mutex{}
+
+var store BlobStore
+
+// GetBlobStore get singleton blob store and create the configured backend if necessary
+func GetBlobStore(config *models.BlobStoreConfig) (BlobStore, error) {
+	if store == nil {
+		lock.Lock()
+		defer lock.Unlock()
+		if store == nil {
+			var err error
+			switch config.Backend {
+			case "local":
+				store, err = NewLocalStore(config.LocalPath)
+			case "s3":
+				store, err = NewS3Store(config)
+			default:
+				err = fmt.Errorf("unknown blob store backend: %s", config.Backend)
+			}
+			if err != nil {
+				store = nil
+				return nil, err
+			}
+		}
+	}
+	return store, nil
+}
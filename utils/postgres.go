@@ -25,5 +25,11 @@ func Connection(config *models.DBConfig) (*gorm.DB, hermesErrors.HermesError) {
 	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
 	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
 
+	// use the recipient model for the join table so per recipient state can be stored
+	err = db.SetupJoinTable(&models.Message{}, "Recipients", &models.Recipient{})
+	if err != nil {
+		return nil, hermesErrors.InternalServerError(fmt.Sprintf("failed to setup recipients join table: %s\n", err))
+	}
+
 	return db, nil
 }
@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// checkTimeout longest the url check before a delivery waits on dns
+const checkTimeout = 5 * time.Second
+
+var (
+	// ErrSchemeNotAllowed the webhook url is not https and http is not allowed
+	ErrSchemeNotAllowed = errors.New("scheme must be https")
+	// ErrAddressNotAllowed the webhook host is on the server or its internal networks and private addresses are not
+	// allowed
+	ErrAddressNotAllowed = errors.New("host resolves to a loopback, private or link local address")
+)
+
+// allowedIP check that the address is not on the host or its internal networks
+func allowedIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
+
+// CheckURL check that the webhook url uses https, unless http is allowed, and that every address its host resolves to
+// is public, unless private addresses are allowed
+func CheckURL(ctx context.Context, config *models.WebhookConfig, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" && !(config.AllowHTTP && parsed.Scheme == "http") {
+		return ErrSchemeNotAllowed
+	}
+	if config.AllowPrivate {
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if !allowedIP(address.IP) {
+			return ErrAddressNotAllowed
+		}
+	}
+	return nil
+}
+
+// NewClient http client for sending deliveries. Redirects are not followed and, unless private addresses are allowed,
+// connections are checked against the address actually dialed so a host can not resolve to a public address when it
+// is checked and a private one when it is connected to.
+func NewClient(config *models.WebhookConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivate {
+		dialer.Control = func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowedIP(ip) {
+				return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// SignatureHeader hmac-sha256 of the timestamp, a dot and the body keyed with the webhook secret
+	SignatureHeader = "X-Hermes-Signature"
+	// TimestampHeader unix time the delivery was sent, receivers should reject old timestamps to prevent replays
+	TimestampHeader = "X-Hermes-Timestamp"
+	EventHeader     = "X-Hermes-Event"
+	// DeliveryHeader id of the delivery, the same for every attempt so receivers can ignore duplicates
+	DeliveryHeader = "X-Hermes-Delivery"
+)
+
+// GenerateSecret random key for signing a webhook's payloads
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign get the signature header value for the timestamp and body
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify check the signature header value in constant time
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Send post a delivery's payload to the webhook, returns the status code and an error if it was not 2xx. The url is
+// checked again before sending as its host may resolve differently than when the webhook was registered.
+func Send(client *http.Client, config *models.WebhookConfig, webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	if err := CheckURL(ctx, config, webhook.URL); err != nil {
+		return 0, err
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(EventHeader, delivery.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
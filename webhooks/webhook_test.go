@@ -0,0 +1,146 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"github.com/Daniel-W-Innes/hermes/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// localConfig allows the plain http loopback urls of test servers
+var localConfig = models.WebhookConfig{Timeout: time.Second, AllowHTTP: true, AllowPrivate: true}
+
+func TestSend(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret %s", err)
+	}
+
+	received := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body %s", err)
+		}
+		received <- Verify(secret, r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)) &&
+			r.Header.Get(EventHeader) == models.EventRecipientAdded && r.Header.Get(DeliveryHeader) == "1"
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Secret: secret}
+	delivery := models.WebhookDelivery{ID: 1, Type: models.EventRecipientAdded, Payload: `{"EventID":1}`}
+
+	status, err := Send(server.Client(), &localConfig, &webhook, &delivery, time.Now())
+	if err != nil {
+		t.Fatalf("failed to send %s", err)
+	} else if status != http.StatusOK {
+		t.Errorf("wrong status %d", status)
+	}
+	if !<-received {
+		t.Errorf("receiver could not verify the delivery")
+	}
+}
+
+func TestSendFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Secret: "secret"}
+	delivery := models.WebhookDelivery{ID: 1, Payload: "{}"}
+
+	status, err := Send(server.Client(), &localConfig, &webhook, &delivery, time.Now())
+	if err == nil {
+		t.Errorf("non 2xx status should fail")
+	} else if status != http.StatusServiceUnavailable {
+		t.Errorf("wrong status %d", status)
+	}
+}
+
+func TestSendRedirect(t *testing.T) {
+	redirected := make(chan bool, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected <- true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Secret: "secret"}
+	delivery := models.WebhookDelivery{ID: 1, Payload: "{}"}
+
+	status, err := Send(NewClient(&localConfig), &localConfig, &webhook, &delivery, time.Now())
+	if err == nil {
+		t.Errorf("redirect should fail")
+	} else if status != http.StatusTemporaryRedirect {
+		t.Errorf("wrong status %d", status)
+	}
+	select {
+	case <-redirected:
+		t.Errorf("redirect was followed")
+	default:
+	}
+}
+
+func TestSendPrivate(t *testing.T) {
+	received := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- true
+	}))
+	defer server.Close()
+
+	config := models.WebhookConfig{Timeout: time.Second, AllowHTTP: true}
+	webhook := models.Webhook{URL: server.URL, Secret: "secret"}
+	delivery := models.WebhookDelivery{ID: 1, Payload: "{}"}
+
+	if _, err := Send(NewClient(&config), &config, &webhook, &delivery, time.Now()); err != ErrAddressNotAllowed {
+		t.Errorf("loopback url should not be sent to %v", err)
+	}
+	// the client checks the address it connects to as well in case the host resolves differently
+	if _, err := NewClient(&config).Post(server.URL, "application/json", nil); !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("client should not connect to loopback %v", err)
+	}
+	select {
+	case <-received:
+		t.Errorf("private address was sent to")
+	default:
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	config := models.WebhookConfig{}
+	for rawURL, expected := range map[string]error{
+		"https://93.184.216.34/hook":   nil,
+		"http://93.184.216.34/hook":    ErrSchemeNotAllowed,
+		"ftp://93.184.216.34/hook":     ErrSchemeNotAllowed,
+		"https://127.0.0.1/hook":       ErrAddressNotAllowed,
+		"https://10.0.0.1/hook":        ErrAddressNotAllowed,
+		"https://192.168.1.1/hook":     ErrAddressNotAllowed,
+		"https://169.254.169.254/hook": ErrAddressNotAllowed,
+		"https://[::1]/hook":           ErrAddressNotAllowed,
+		"https://[fe80::1]/hook":       ErrAddressNotAllowed,
+		"https://0.0.0.0/hook":         ErrAddressNotAllowed,
+	} {
+		if err := CheckURL(context.Background(), &config, rawURL); err != expected {
+			t.Errorf("wrong result for %s expected %v actual %v", rawURL, expected, err)
+		}
+	}
+
+	if err := CheckURL(context.Background(), &localConfig, "http://127.0.0.1/hook"); err != nil {
+		t.Errorf("allowed url was rejected %s", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	signature := Sign("secret", "1", []byte(`{"EventID":1}`))
+	if Verify("secret", "1", []byte(`{"EventID":2}`), signature) {
+		t.Errorf("tampered body should not verify")
+	} else if Verify("secret", "2", []byte(`{"EventID":1}`), signature) {
+		t.Errorf("changed timestamp should not verify")
+	}
+}